@@ -0,0 +1,205 @@
+// (C) 2017 Christoph Berger <mail@christophberger.com>. Some rights reserved.
+// Distributed under a 3-clause BSD license; see LICENSE.txt.
+
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"golang.org/x/mod/module"
+)
+
+// tokenEnvs maps hosts to the environment variables that may hold an access
+// token for the host. The first non-empty variable wins. Hosts from the
+// configuration file are added by config.apply().
+var tokenEnvs = map[string][]string{
+	"github.com":                {"GITHUB_TOKEN", "GH_TOKEN"},
+	"api.github.com":            {"GITHUB_TOKEN", "GH_TOKEN"},
+	"raw.githubusercontent.com": {"GITHUB_TOKEN", "GH_TOKEN"},
+	"gitlab.com":                {"GITLAB_TOKEN"},
+	"codeberg.org":              {"CODEBERG_TOKEN"},
+	"bitbucket.org":             {"BITBUCKET_TOKEN"},
+	"api.bitbucket.org":         {"BITBUCKET_TOKEN"},
+}
+
+// authTransport adds credentials to outgoing requests that carry none yet:
+// an access token from the environment, or else the login and password for
+// the host from the .netrc file, which is the same file that the go command uses.
+// Credentials of either kind are sent over https only, so that they cannot
+// leak in plain text, not even after a redirect to an http:// URL.
+type authTransport struct {
+	base http.RoundTripper
+
+	once  sync.Once
+	netrc []netrcLine
+}
+
+func (t *authTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.URL.Scheme != "https" || r.Header.Get("Authorization") != "" || r.Header.Get("Private-Token") != "" {
+		return t.base.RoundTrip(r)
+	}
+
+	host := strings.ToLower(r.URL.Hostname())
+	if token := tokenFor(host); token != "" {
+		r = r.Clone(r.Context())
+		if _, ok := forgeFor(host).(gitlabForge); ok {
+			r.Header.Set("Private-Token", token)
+		} else {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		return t.base.RoundTrip(r)
+	}
+
+	t.once.Do(func() {
+		t.netrc = readNetrc()
+	})
+	for _, l := range t.netrc {
+		if l.machine == host {
+			r = r.Clone(r.Context())
+			r.SetBasicAuth(l.login, l.password)
+			break
+		}
+	}
+	return t.base.RoundTrip(r)
+}
+
+// tokenFor returns the access token for host, or an empty string.
+func tokenFor(host string) string {
+	for _, env := range tokenEnvs[host] {
+		if token := os.Getenv(env); token != "" {
+			return token
+		}
+	}
+	return ""
+}
+
+// noProxy reports whether module mod must be fetched directly from its
+// repository rather than through a module proxy. Like the go command, goman
+// takes the patterns from GONOPROXY, which defaults to GOPRIVATE.
+func noProxy(mod string) bool {
+	patterns := goEnv("GONOPROXY")
+	if patterns == "" {
+		patterns = goEnv("GOPRIVATE")
+	}
+	return module.MatchPrefixPatterns(patterns, mod)
+}
+
+// noPublicProxy reports whether module mod must not be requested from
+// proxy.golang.org. This is the case for all modules that GONOSUMDB
+// (which defaults to GOPRIVATE) declares as private: The public proxy cannot
+// know them, and asking for them would leak the module path. Proxies that
+// are run by the user's organization are still allowed.
+func noPublicProxy(mod string) bool {
+	patterns := goEnv("GONOSUMDB")
+	if patterns == "" {
+		patterns = goEnv("GOPRIVATE")
+	}
+	return module.MatchPrefixPatterns(patterns, mod)
+}
+
+// isPublicProxy reports whether the proxy URL points to proxy.golang.org.
+func isPublicProxy(proxyURL string) bool {
+	u, err := url.Parse(proxyURL)
+	return err == nil && strings.EqualFold(u.Hostname(), "proxy.golang.org")
+}
+
+// netrcLine is a machine entry of a .netrc file.
+type netrcLine struct {
+	machine  string
+	login    string
+	password string
+}
+
+// readNetrc reads and parses the .netrc file. Errors result in no entries.
+func readNetrc() []netrcLine {
+	path, err := netrcPath()
+	if err != nil {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	return parseNetrc(string(data))
+}
+
+// netrcPath returns the path of the .netrc file: $NETRC, or ~/.netrc
+// (~/_netrc takes precedence on Windows).
+//
+// This function and parseNetrc are copied from cmd/go/internal/auth/netrc.go.
+func netrcPath() (string, error) {
+	if env := os.Getenv("NETRC"); env != "" {
+		return env, nil
+	}
+	dir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	// Prioritize _netrc on Windows for compatibility.
+	if runtime.GOOS == "windows" {
+		legacyPath := filepath.Join(dir, "_netrc")
+		_, err := os.Stat(legacyPath)
+		if err == nil {
+			return legacyPath, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	// Use the .netrc file (fall back to it if we're on Windows).
+	return filepath.Join(dir, ".netrc"), nil
+}
+
+// parseNetrc parses the content of a .netrc file. See
+// https://www.gnu.org/software/inetutils/manual/html_node/The-_002enetrc-file.html
+// for documentation on the .netrc format.
+func parseNetrc(data string) []netrcLine {
+	var nrc []netrcLine
+	var l netrcLine
+	inMacro := false
+	for _, line := range strings.Split(data, "\n") {
+		if inMacro {
+			if line == "" {
+				inMacro = false
+			}
+			continue
+		}
+
+		f := strings.Fields(line)
+		i := 0
+		for ; i < len(f)-1; i += 2 {
+			// Reset at each "machine" token.
+			switch f[i] {
+			case "machine":
+				l = netrcLine{machine: f[i+1]}
+			case "default":
+				break
+			case "login":
+				l.login = f[i+1]
+			case "password":
+				l.password = f[i+1]
+			case "macdef":
+				// The macro continues until a null line is encountered.
+				inMacro = true
+			}
+			if l.machine != "" && l.login != "" && l.password != "" {
+				nrc = append(nrc, l)
+				l = netrcLine{}
+			}
+		}
+
+		if i < len(f) && f[i] == "default" {
+			// There can be only one default token, and it must be after all machine tokens.
+			break
+		}
+	}
+
+	return nrc
+}
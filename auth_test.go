@@ -0,0 +1,138 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_parseNetrc(t *testing.T) {
+	data := `machine git.example.com login alice password secret1
+machine api.example.com
+	login bob
+	password secret2
+macdef init
+machine ignored.example.com login x password y
+
+machine gitlab.example.com login carol password secret3
+default
+login anonymous password guest
+machine after.default.com login x password y
+`
+	want := []netrcLine{
+		{"git.example.com", "alice", "secret1"},
+		{"api.example.com", "bob", "secret2"},
+		{"gitlab.example.com", "carol", "secret3"},
+	}
+	if got := parseNetrc(data); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseNetrc()\ngot  %v\nwant %v", got, want)
+	}
+}
+
+func Test_authTransport(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Authorization", r.Header.Get("Authorization"))
+		w.Header().Set("X-Private-Token", r.Header.Get("Private-Token"))
+	}))
+	defer srv.Close()
+
+	defer func(e map[string][]string, f []forge) { tokenEnvs, forges = e, f }(tokenEnvs, forges)
+	tokenEnvs = map[string][]string{}
+
+	netrc := filepath.Join(t.TempDir(), "netrc")
+	writeFiles(t, filepath.Dir(netrc), map[string]string{
+		"netrc": "machine 127.0.0.1 login alice password secret\n",
+	})
+	t.Setenv("NETRC", netrc)
+	t.Setenv("TEST_TOKEN", "t0ken")
+
+	tests := []struct {
+		name      string
+		setup     func()
+		auth      string
+		privToken string
+	}{
+		{"netrc", func() {}, "Basic YWxpY2U6c2VjcmV0", ""},
+		{"bearer token", func() { tokenEnvs["127.0.0.1"] = []string{"UNSET_TOKEN", "TEST_TOKEN"} }, "Bearer t0ken", ""},
+		{"gitlab token", func() { _ = registerForge("gitlab", "127.0.0.1", "") }, "", "t0ken"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.setup()
+			client := &http.Client{Transport: &authTransport{base: srv.Client().Transport}}
+			response, err := client.Get(srv.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = response.Body.Close()
+			if got := response.Header.Get("X-Authorization"); got != tt.auth {
+				t.Errorf("Authorization = %q, want %q", got, tt.auth)
+			}
+			if got := response.Header.Get("X-Private-Token"); got != tt.privToken {
+				t.Errorf("Private-Token = %q, want %q", got, tt.privToken)
+			}
+		})
+	}
+
+	t.Run("no credentials over http", func(t *testing.T) {
+		plain := httptest.NewServer(srv.Config.Handler)
+		defer plain.Close()
+		tokenEnvs = map[string][]string{}
+		forges = nil
+		client := &http.Client{Transport: &authTransport{base: http.DefaultTransport}}
+		response, err := client.Get(plain.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = response.Body.Close()
+		if got := response.Header.Get("X-Authorization"); got != "" {
+			t.Errorf("Authorization = %q, want none for http", got)
+		}
+	})
+}
+
+func Test_noProxy(t *testing.T) {
+	tests := []struct {
+		name          string
+		goprivate     string
+		gonoproxy     string
+		gonosumdb     string
+		mod           string
+		noProxy       bool
+		noPublicProxy bool
+	}{
+		{"public", "", "", "", "github.com/user/repo", false, false},
+		{"goprivate", "*.corp.example.com,github.com/corp", "", "", "github.com/corp/tool", true, true},
+		{"goprivate glob", "*.corp.example.com", "", "", "git.corp.example.com/tool", true, true},
+		{"gonoproxy overrides goprivate", "github.com/corp", "none", "", "github.com/corp/tool", false, true},
+		{"gonosumdb only", "", "none", "github.com/corp", "github.com/corp/tool", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GOPRIVATE", tt.goprivate)
+			t.Setenv("GONOPROXY", tt.gonoproxy)
+			t.Setenv("GONOSUMDB", tt.gonosumdb)
+			if got := noProxy(tt.mod); got != tt.noProxy {
+				t.Errorf("noProxy(%q) = %v, want %v", tt.mod, got, tt.noProxy)
+			}
+			if got := noPublicProxy(tt.mod); got != tt.noPublicProxy {
+				t.Errorf("noPublicProxy(%q) = %v, want %v", tt.mod, got, tt.noPublicProxy)
+			}
+		})
+	}
+}
+
+func Test_isPublicProxy(t *testing.T) {
+	for url, want := range map[string]bool{
+		"https://proxy.golang.org":         true,
+		"https://Proxy.Golang.org/":        true,
+		"https://goproxy.corp.example.com": false,
+		"file:///tmp/proxy":                false,
+	} {
+		if got := isPublicProxy(url); got != want {
+			t.Errorf("isPublicProxy(%q) = %v, want %v", url, got, want)
+		}
+	}
+}
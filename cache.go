@@ -0,0 +1,370 @@
+// (C) 2017 Christoph Berger <mail@christophberger.com>. Some rights reserved.
+// Distributed under a 3-clause BSD license; see LICENSE.txt.
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// cacheTTL is the lifetime of cached README files that were fetched from a branch.
+	// README files fetched at a version tag or commit do not expire.
+	cacheTTL = 24 * time.Hour
+	// negativeCacheTTL is the lifetime of the memory of not having found a README.
+	negativeCacheTTL = time.Hour
+)
+
+// readmeCache is the README cache in effect; nil if caching is not possible.
+var readmeCache *cache
+
+// errCacheMiss means that the cache knows nothing (current) about a README.
+var errCacheMiss = errors.New("not in cache")
+
+// cacheEntry is a README file in the cache, or the memory of not having found one.
+type cacheEntry struct {
+	Key      string    `json:"key"`
+	Source   string    `json:"source,omitempty"`
+	Content  []byte    `json:"content,omitempty"`
+	Fetched  time.Time `json:"fetched"`
+	Expires  time.Time `json:"expires,omitempty"` // zero for entries that never expire
+	Negative bool      `json:"negative,omitempty"`
+
+	// Validators for revalidating an expired entry with a conditional request
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// expired reports whether the entry is past its lifetime.
+func (e cacheEntry) expired(now time.Time) bool {
+	return !e.Expires.IsZero() && now.After(e.Expires)
+}
+
+// revalidatable reports whether the entry can be revalidated with a conditional request.
+func (e cacheEntry) revalidatable() bool {
+	return !e.Negative && (e.ETag != "" || e.LastModified != "") &&
+		(strings.HasPrefix(e.Source, "https://") || strings.HasPrefix(e.Source, "http://"))
+}
+
+// String describes the entry's metadata, for verbose output.
+func (e cacheEntry) String() string {
+	s := fmt.Sprintf("cache entry %s: %s, fetched %s", e.Key, e.status(time.Now()), e.Fetched.Format(time.RFC3339))
+	if e.ETag != "" {
+		s += ", ETag " + e.ETag
+	}
+	if e.LastModified != "" {
+		s += ", Last-Modified " + e.LastModified
+	}
+	return s
+}
+
+// cache is a directory with one JSON file per entry. Entries are written
+// atomically (write to a temporary file, then rename), so concurrent goman
+// processes never see partial entries.
+type cache struct {
+	dir string
+}
+
+// newCache returns the cache in the goman directory of the user's cache
+// directory, e.g. ~/.cache/goman/readme on Linux.
+func newCache() (*cache, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot determine the user cache directory")
+	}
+	return &cache{dir: filepath.Join(dir, "goman", "readme")}, nil
+}
+
+// cacheKey returns the key for the README of package pkg at version ver.
+// Binaries that were not built from a tagged module version use the
+// VCS revision, and if there is none, the default branch ("HEAD").
+func cacheKey(pkg string, bi binInfo) string {
+	switch {
+	case bi.Version != "":
+		return pkg + "@" + bi.Version
+	case bi.Revision != "":
+		return pkg + "@" + bi.Revision
+	}
+	return pkg + "@HEAD"
+}
+
+// path returns the file path of the entry for key.
+func (c *cache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:16])+".json")
+}
+
+// get returns the entry for key, which may be expired.
+func (c *cache) get(key string) (cacheEntry, bool) {
+	var e cacheEntry
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return e, false
+	}
+	if err := json.Unmarshal(data, &e); err != nil || e.Key != key {
+		return e, false
+	}
+	return e, true
+}
+
+// put stores the entry atomically.
+func (c *cache) put(e cacheEntry) error {
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return errors.Wrap(err, "cannot create cache directory")
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err, "cannot encode cache entry")
+	}
+
+	f, err := os.CreateTemp(c.dir, ".tmp-*")
+	if err != nil {
+		return errors.Wrap(err, "cannot create cache entry")
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), c.path(e.Key))
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return errors.Wrap(err, "cannot write cache entry")
+	}
+	return nil
+}
+
+// storeReadme caches the README in e. If immutable is false, the entry expires after cacheTTL.
+func (c *cache) storeReadme(e cacheEntry, immutable bool) error {
+	e.Fetched = time.Now()
+	e.Expires = time.Time{}
+	if !immutable {
+		e.Expires = e.Fetched.Add(cacheTTL)
+	}
+	return c.put(e)
+}
+
+// storeMiss caches the information that no README exists for key.
+func (c *cache) storeMiss(key string) error {
+	now := time.Now()
+	return c.put(cacheEntry{Key: key, Fetched: now, Expires: now.Add(negativeCacheTTL), Negative: true})
+}
+
+// findCachedReadme is a helper function for findReadme. It returns the cached
+// README for key, or errCacheMiss. If the cache remembers that there is no
+// README, findCachedReadme returns an error other than errCacheMiss.
+//
+// An expired README is revalidated with a conditional request to the URL that
+// it came from. If the server responds that the README is unchanged, the entry
+// gets a new lifetime. If the network fails, findCachedReadme returns the
+// expired README, as it is still more likely to be right than wrong.
+func findCachedReadme(key string) (readme []byte, source string, err error) {
+	if readmeCache == nil {
+		return nil, "", errCacheMiss
+	}
+	e, ok := readmeCache.get(key)
+	if !ok {
+		return nil, "", errCacheMiss
+	}
+	if *verbose {
+		log.Println(e)
+	}
+
+	if !e.expired(time.Now()) {
+		if e.Negative {
+			return nil, "", errors.Errorf("no README for %s (cached result from %s)", key, e.Fetched.Format(time.RFC3339))
+		}
+		return e.Content, e.Source + " (cached)", nil
+	}
+	if *offline || !e.revalidatable() {
+		return nil, "", errCacheMiss
+	}
+
+	r, err := revalidate(e)
+	switch {
+	case err == nil && r.NotModified:
+		if r.ETag != "" {
+			e.ETag = r.ETag
+		}
+		cacheReadme(e, false)
+		return e.Content, e.Source + " (cached, revalidated)", nil
+	case err == nil:
+		e.Content, e.ETag, e.LastModified = r.Content, r.ETag, r.LastModified
+		cacheReadme(e, false)
+		return e.Content, e.Source, nil
+	}
+	if *verbose {
+		log.Println(errors.Wrap(err, "cannot revalidate "+key))
+	}
+	if _, notFound := errors.Cause(err).(errNotFound); notFound {
+		// The README has moved; look it up again.
+		return nil, "", errCacheMiss
+	}
+	return e.Content, e.Source + " (cached, expired; revalidation failed)", nil
+}
+
+// revalidate sends a conditional request for the README in entry e.
+func revalidate(e cacheEntry) (httpReadme, error) {
+	header := http.Header{}
+	if e.ETag != "" {
+		header.Set("If-None-Match", e.ETag)
+	}
+	if e.LastModified != "" {
+		header.Set("If-Modified-Since", e.LastModified)
+	}
+	return httpGetReadme(context.Background(), e.Source, header)
+}
+
+// staleReadme returns the cached README for key even if it is expired.
+// findReadme uses it when the network fails, or in offline mode.
+func staleReadme(key string) (readme []byte, source string, err error) {
+	if readmeCache == nil {
+		return nil, "", errCacheMiss
+	}
+	e, ok := readmeCache.get(key)
+	if !ok || e.Negative {
+		return nil, "", errCacheMiss
+	}
+	return e.Content, e.Source + " (cached, expired)", nil
+}
+
+// cacheReadme is a helper function for findReadme that stores a README
+// in the cache, if there is one. Errors are logged in verbose mode only.
+func cacheReadme(e cacheEntry, immutable bool) {
+	if readmeCache == nil {
+		return
+	}
+	if err := readmeCache.storeReadme(e, immutable); err != nil && *verbose {
+		log.Println(err)
+	}
+}
+
+// cacheMiss is a helper function for findReadme that stores
+// the information that no README was found for key.
+func cacheMiss(key string) {
+	if readmeCache == nil {
+		return
+	}
+	if err := readmeCache.storeMiss(key); err != nil && *verbose {
+		log.Println(err)
+	}
+}
+
+// list returns all entries, sorted by key.
+func (c *cache) list() ([]cacheEntry, error) {
+	files, err := filepath.Glob(filepath.Join(c.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var entries []cacheEntry
+	for _, fp := range files {
+		data, err := os.ReadFile(fp)
+		if err != nil {
+			continue
+		}
+		var e cacheEntry
+		if json.Unmarshal(data, &e) == nil {
+			entries = append(entries, e)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	return entries, nil
+}
+
+// prune removes all expired entries, and leftovers of interrupted writes.
+// It returns the number of removed entries.
+func (c *cache) prune(now time.Time) (int, error) {
+	files, err := os.ReadDir(c.dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, errors.Wrap(err, "cannot read cache directory")
+	}
+	n := 0
+	for _, f := range files {
+		fp := filepath.Join(c.dir, f.Name())
+		if strings.HasPrefix(f.Name(), ".tmp-") {
+			if info, err := f.Info(); err == nil && now.Sub(info.ModTime()) > time.Hour {
+				_ = os.Remove(fp)
+			}
+			continue
+		}
+		data, err := os.ReadFile(fp)
+		if err != nil {
+			continue
+		}
+		var e cacheEntry
+		if json.Unmarshal(data, &e) != nil || e.expired(now) {
+			if os.Remove(fp) == nil {
+				n++
+			}
+		}
+	}
+	return n, nil
+}
+
+// clear removes the whole cache.
+func (c *cache) clear() error {
+	return errors.Wrap(os.RemoveAll(c.dir), "cannot remove cache directory")
+}
+
+// runCacheCommand runs `goman cache <cmd>`.
+func runCacheCommand(c *cache, cmd string) error {
+	if c == nil {
+		return errors.New("no cache directory available")
+	}
+	now := time.Now()
+	switch cmd {
+	case "ls":
+		entries, err := c.list()
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			fmt.Printf("%s\t%s\t%s\n", e.Key, e.status(now), e.Source)
+		}
+	case "clear":
+		return c.clear()
+	case "prune":
+		n, err := c.prune(now)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Removed %d expired entries from %s\n", n, c.dir)
+	default:
+		return errors.Errorf("unknown cache command %q (use ls, clear, or prune)", cmd)
+	}
+	return nil
+}
+
+// status describes the state of an entry for `goman cache ls`.
+func (e cacheEntry) status(now time.Time) string {
+	s := "found"
+	if e.Negative {
+		s = "not found"
+	}
+	switch {
+	case e.Expires.IsZero():
+		s += ", immutable"
+	case e.expired(now):
+		s += ", expired"
+	default:
+		s += ", expires " + e.Expires.Format(time.RFC3339)
+	}
+	return s
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_cacheKey(t *testing.T) {
+	tests := []struct {
+		name string
+		bi   binInfo
+		want string
+	}{
+		{"version", binInfo{Version: "v1.2.3", Revision: "abc"}, "github.com/user/repo/cmd/tool@v1.2.3"},
+		{"revision", binInfo{Revision: "abc"}, "github.com/user/repo/cmd/tool@abc"},
+		{"nothing", binInfo{}, "github.com/user/repo/cmd/tool@HEAD"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cacheKey("github.com/user/repo/cmd/tool", tt.bi); got != tt.want {
+				t.Errorf("cacheKey() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_findCachedReadme(t *testing.T) {
+	defer func(c *cache, v, o *bool) { readmeCache, verbose, offline = c, v, o }(readmeCache, verbose, offline)
+	readmeCache = &cache{dir: t.TempDir()}
+	verbose, offline = new(bool), new(bool)
+
+	if _, _, err := findCachedReadme("example.com/tool@v1.0.0"); err != errCacheMiss {
+		t.Errorf("findCachedReadme() of an unknown key: %v, want errCacheMiss", err)
+	}
+
+	cacheReadme(cacheEntry{Key: "example.com/tool@v1.0.0", Content: []byte("readme"), Source: "https://example.com/README.md"}, true)
+	readme, source, err := findCachedReadme("example.com/tool@v1.0.0")
+	if err != nil || string(readme) != "readme" || source != "https://example.com/README.md (cached)" {
+		t.Errorf("findCachedReadme() = %q, %q, %v", readme, source, err)
+	}
+
+	cacheMiss("example.com/tool@v2.0.0")
+	if _, _, err := findCachedReadme("example.com/tool@v2.0.0"); err == nil || err == errCacheMiss {
+		t.Errorf("findCachedReadme() of a cached miss: %v, want a not-found error", err)
+	}
+}
+
+func Test_findCachedReadme_revalidate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/unchanged":
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		case "/modified":
+			if r.Header.Get("If-Modified-Since") == "Mon, 02 Jan 2006 15:04:05 GMT" {
+				w.Header().Set("ETag", `"v2"`)
+				_, _ = w.Write([]byte("new readme"))
+				return
+			}
+		}
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	defer func(c *cache, v, o *bool, ttl time.Duration) {
+		readmeCache, verbose, offline, cacheTTL = c, v, o, ttl
+	}(readmeCache, verbose, offline, cacheTTL)
+	readmeCache = &cache{dir: t.TempDir()}
+	verbose, offline = new(bool), new(bool)
+
+	tests := []struct {
+		name        string
+		entry       cacheEntry
+		want        string
+		wantSource  string
+		wantMiss    bool
+		wantETag    string
+		wantExpired bool
+	}{
+		{"not modified", cacheEntry{Source: srv.URL + "/unchanged", ETag: `"v1"`},
+			"old readme", srv.URL + "/unchanged (cached, revalidated)", false, `"v1"`, false},
+		{"modified", cacheEntry{Source: srv.URL + "/modified", LastModified: "Mon, 02 Jan 2006 15:04:05 GMT"},
+			"new readme", srv.URL + "/modified", false, `"v2"`, false},
+		{"gone", cacheEntry{Source: srv.URL + "/gone", ETag: `"v1"`},
+			"", "", true, `"v1"`, true},
+		{"network failure", cacheEntry{Source: down.URL + "/README.md", ETag: `"v1"`},
+			"old readme", down.URL + "/README.md (cached, expired; revalidation failed)", false, `"v1"`, true},
+		{"no validators", cacheEntry{Source: srv.URL + "/unchanged"},
+			"", "", true, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.entry.Key = "example.com/" + tt.name + "@HEAD"
+			tt.entry.Content = []byte("old readme")
+			cacheTTL = -time.Minute
+			if err := readmeCache.storeReadme(tt.entry, false); err != nil {
+				t.Fatal(err)
+			}
+			cacheTTL = time.Hour
+
+			readme, source, err := findCachedReadme(tt.entry.Key)
+			if tt.wantMiss {
+				if err != errCacheMiss {
+					t.Errorf("findCachedReadme() = %q, %v, want errCacheMiss", readme, err)
+				}
+			} else if err != nil || string(readme) != tt.want || source != tt.wantSource {
+				t.Errorf("findCachedReadme() = %q, %q, %v, want %q, %q", readme, source, err, tt.want, tt.wantSource)
+			}
+
+			e, _ := readmeCache.get(tt.entry.Key)
+			if e.ETag != tt.wantETag || e.expired(time.Now()) != tt.wantExpired {
+				t.Errorf("cache entry after revalidation: %v", e)
+			}
+		})
+	}
+}
+
+func Test_cache_expiry(t *testing.T) {
+	defer func(ttl, nttl time.Duration) { cacheTTL, negativeCacheTTL = ttl, nttl }(cacheTTL, negativeCacheTTL)
+	cacheTTL, negativeCacheTTL = time.Hour, time.Minute
+
+	c := &cache{dir: t.TempDir()}
+	for _, err := range []error{
+		c.storeReadme(cacheEntry{Key: "tagged@v1.0.0", Content: []byte("v1"), Source: "proxy"}, true),
+		c.storeReadme(cacheEntry{Key: "branch@HEAD", Content: []byte("main"), Source: "raw"}, false),
+		c.storeMiss("missing@v1.0.0"),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Leftover of an interrupted write
+	tmp := filepath.Join(c.dir, ".tmp-123")
+	if err := os.WriteFile(tmp, []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(tmp, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := c.list()
+	if err != nil || len(entries) != 3 {
+		t.Fatalf("list() = %v, %v, want 3 entries", entries, err)
+	}
+	if entries[0].Key != "branch@HEAD" || entries[2].Key != "tagged@v1.0.0" {
+		t.Errorf("list() is not sorted by key: %v", entries)
+	}
+
+	tests := []struct {
+		after       time.Duration
+		wantPruned  int
+		wantEntries int
+	}{
+		{0, 0, 3},
+		{30 * time.Minute, 1, 2},      // the miss expired
+		{30 * 24 * time.Hour, 1, 1},   // the branch README expired
+		{3650 * 24 * time.Hour, 0, 1}, // the tagged README stays
+	}
+	for _, tt := range tests {
+		n, err := c.prune(time.Now().Add(tt.after))
+		if err != nil || n != tt.wantPruned {
+			t.Errorf("prune(+%v) = %d, %v, want %d", tt.after, n, err, tt.wantPruned)
+		}
+		if entries, _ := c.list(); len(entries) != tt.wantEntries {
+			t.Errorf("after prune(+%v): %d entries, want %d", tt.after, len(entries), tt.wantEntries)
+		}
+	}
+	if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+		t.Errorf("prune() left the temporary file in place")
+	}
+
+	if err := c.clear(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.get("tagged@v1.0.0"); ok {
+		t.Errorf("get() after clear() found an entry")
+	}
+}
+
+func Test_cache_concurrentPut(t *testing.T) {
+	c := &cache{dir: t.TempDir()}
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = c.storeReadme(cacheEntry{Key: "tool@v1.0.0", Content: []byte("readme"), Source: "proxy"}, true)
+		}()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if e, ok := c.get("tool@v1.0.0"); ok && string(e.Content) != "readme" {
+				t.Errorf("get() returned a partial entry: %+v", e)
+			}
+		}()
+	}
+	wg.Wait()
+	files, _ := filepath.Glob(filepath.Join(c.dir, "*"))
+	if len(files) != 1 {
+		t.Errorf("cache directory contains %v, want one entry", files)
+	}
+}
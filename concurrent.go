@@ -0,0 +1,89 @@
+// (C) 2017 Christoph Berger <mail@christophberger.com>. Some rights reserved.
+// Distributed under a 3-clause BSD license; see LICENSE.txt.
+
+package main
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// maxParallelRequests limits the number of HTTP requests that run at the same time.
+const maxParallelRequests = 8
+
+// fetchResult is the outcome of fetching candidate i.
+type fetchResult struct {
+	i    int
+	data []byte
+	err  error
+}
+
+// firstSuccess calls fetch for the candidates 0...n-1 concurrently, with at most
+// `parallel` calls running at the same time. Candidates are ordered by priority:
+// a lower index wins over a higher one. Hence firstSuccess returns as soon as
+// a candidate succeeds and all candidates with a lower index have failed.
+// Candidates with a higher index than the winner are canceled via their context
+// or not started at all.
+//
+// If all candidates fail, firstSuccess returns -1 and the error of the first
+// candidate.
+func firstSuccess(ctx context.Context, n, parallel int, fetch func(ctx context.Context, i int) ([]byte, error)) (int, []byte, error) {
+
+	if n == 0 {
+		return -1, nil, errors.New("no candidates to fetch")
+	}
+
+	ctx, cancelAll := context.WithCancel(ctx)
+	defer cancelAll()
+
+	// Buffered, so that goroutines that finish after we returned do not block.
+	results := make(chan fetchResult, n)
+	cancels := make([]context.CancelFunc, n)
+	done := make([]fetchResult, n)
+	finished := make([]bool, n)
+
+	next := 0    // next candidate to start
+	running := 0 // number of running fetches
+	best := n    // lowest index that succeeded so far
+	failed := 0  // all candidates below this index have failed
+
+	for {
+		for running < parallel && next < best {
+			var c context.Context
+			c, cancels[next] = context.WithCancel(ctx)
+			go func(ctx context.Context, i int) {
+				data, err := fetch(ctx, i)
+				results <- fetchResult{i: i, data: data, err: err}
+			}(c, next)
+			next++
+			running++
+		}
+		if running == 0 {
+			break
+		}
+
+		r := <-results
+		running--
+		cancels[r.i]()
+		done[r.i] = r
+		finished[r.i] = true
+
+		if r.err == nil && r.i < best {
+			best = r.i
+			// Lower-priority candidates are not needed anymore.
+			for i := best + 1; i < next; i++ {
+				cancels[i]()
+			}
+		}
+
+		for failed < n && finished[failed] && done[failed].err != nil {
+			failed++
+		}
+		if failed == best && best < n {
+			return best, done[best].data, nil
+		}
+	}
+
+	return -1, nil, done[0].err
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_firstSuccess(t *testing.T) {
+	type outcome struct {
+		delay time.Duration
+		ok    bool
+	}
+	tests := []struct {
+		name     string
+		outcomes []outcome
+		want     int
+	}{
+		{"first wins", []outcome{{0, true}, {0, true}}, 0},
+		{"slow first still wins", []outcome{{50 * time.Millisecond, true}, {0, true}, {0, true}}, 0},
+		{"fast later candidate waits for failures", []outcome{{30 * time.Millisecond, false}, {0, true}, {10 * time.Millisecond, true}}, 1},
+		{"last remaining", []outcome{{0, false}, {0, false}, {0, false}, {20 * time.Millisecond, true}}, 3},
+		{"all fail", []outcome{{0, false}, {0, false}}, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i, data, err := firstSuccess(context.Background(), len(tt.outcomes), 2, func(ctx context.Context, i int) ([]byte, error) {
+				select {
+				case <-time.After(tt.outcomes[i].delay):
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+				if !tt.outcomes[i].ok {
+					return nil, errors.New("failed")
+				}
+				return []byte{byte(i)}, nil
+			})
+			if i != tt.want {
+				t.Fatalf("firstSuccess() = %d, want %d (err: %v)", i, tt.want, err)
+			}
+			if i >= 0 && (err != nil || len(data) != 1 || int(data[0]) != i) {
+				t.Errorf("firstSuccess() returned data %v, err %v for candidate %d", data, err, i)
+			}
+			if i < 0 && err == nil {
+				t.Errorf("firstSuccess() returned no error")
+			}
+		})
+	}
+}
+
+func Test_firstSuccess_parallelism(t *testing.T) {
+	var running, maxRunning, started int32
+	_, _, _ = firstSuccess(context.Background(), 20, 3, func(ctx context.Context, i int) ([]byte, error) {
+		atomic.AddInt32(&started, 1)
+		n := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		defer atomic.AddInt32(&running, -1)
+		if i == 10 {
+			return []byte("ok"), nil
+		}
+		time.Sleep(5 * time.Millisecond)
+		return nil, errors.New("failed")
+	})
+	if m := atomic.LoadInt32(&maxRunning); m > 3 {
+		t.Errorf("firstSuccess() ran %d fetches concurrently, want at most 3", m)
+	}
+	if s := atomic.LoadInt32(&started); s > 13 {
+		t.Errorf("firstSuccess() started %d fetches, want no more than 13 after candidate 10 succeeded", s)
+	}
+}
+
+func Test_findRemoteReadme(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/README"):
+			_, _ = w.Write([]byte("plain readme"))
+			return
+		case strings.HasSuffix(r.URL.Path, "/readme.md"):
+			_, _ = w.Write([]byte("lower-case readme"))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	src := strings.TrimPrefix(srv.URL, "http://")
+	defer func(c *http.Client, v *bool) { httpClient, verbose = c, v }(httpClient, verbose)
+	httpClient = &http.Client{Transport: rewriteScheme{}}
+	verbose = new(bool)
+
+	r, url, _, err := findRemoteReadme([]location{{Root: src}}, "")
+	if err != nil {
+		t.Fatalf("findRemoteReadme(): %v", err)
+	}
+	if string(r.Content) != "plain readme" || url != "https://"+src+"/README" {
+		t.Errorf("findRemoteReadme() = %q from %s, want the README, which precedes readme.md", r.Content, url)
+	}
+}
+
+func Test_findRemoteReadme_rateLimited(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	defer func(c *http.Client, n int, v *bool) { httpClient, maxRetries, verbose = c, n, v }(httpClient, maxRetries, verbose)
+	httpClient = &http.Client{Transport: rewriteScheme{}}
+	maxRetries, verbose = 0, new(bool)
+
+	root := strings.TrimPrefix(srv.URL, "http://")
+	_, _, _, err := findRemoteReadme([]location{{Root: root, Dir: "cmd/tool"}, {Root: root, Dir: "cmd"}, {Root: root}}, "")
+	var rl *rateLimitError
+	if !errors.As(err, &rl) {
+		t.Errorf("findRemoteReadme() error = %v, want a rate limit error", err)
+	}
+	// After the rate limit, only the requests that were already running went out.
+	if n := requests.Load(); n > maxParallelRequests {
+		t.Errorf("findRemoteReadme() sent %d requests, want at most %d", n, maxParallelRequests)
+	}
+}
+
+func Test_findRemoteReadme_apiRateLimited(t *testing.T) {
+	var apiRequests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Host == "api.github.com":
+			apiRequests.Add(1)
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+			w.WriteHeader(http.StatusForbidden)
+		case r.Host == "raw.githubusercontent.com" && r.URL.Path == "/user/repo/master/README.TXT":
+			_, _ = w.Write([]byte("# Repo\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	defer func(c *http.Client, n int, v *bool) { httpClient, maxRetries, verbose = c, n, v }(httpClient, maxRetries, verbose)
+	httpClient = &http.Client{Transport: hostHeader{toServer{u}}}
+	maxRetries, verbose = 0, new(bool)
+
+	// The README comes from a guessed branch, without asking the API for the default branch.
+	// It is the last candidate, so that no request is still running when the test ends.
+	r, _, _, err := findRemoteReadme([]location{{Root: "github.com/user/repo"}}, "")
+	if err != nil || string(r.Content) != "# Repo\n" {
+		t.Errorf("findRemoteReadme() = %q, %v, want the README", r.Content, err)
+	}
+	if n := apiRequests.Load(); n != 1 {
+		t.Errorf("findRemoteReadme() sent %d API requests, want 1", n)
+	}
+}
+
+// rewriteScheme lets tests send requests for https:// URLs to a plain httptest server.
+type rewriteScheme struct{}
+
+func (rewriteScheme) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.URL.Scheme = "http"
+	return http.DefaultTransport.RoundTrip(r)
+}
@@ -0,0 +1,172 @@
+// (C) 2017 Christoph Berger <mail@christophberger.com>. Some rights reserved.
+// Distributed under a 3-clause BSD license; see LICENSE.txt.
+
+package main
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+)
+
+// config is the content of the configuration file. Example:
+//
+//	timeout = "20s"
+//	remote_only = true
+//	names = ["README.md", "README.rst", "README"]
+//	branches = ["develop"]
+//	cache_ttl = "12h"
+//	negative_cache_ttl = "30m"
+//	max_size = 2097152
+//	retries = 5
+//	max_retry_wait = "30s"
+//
+//	[[hosts]]
+//	host = "git.example.com"
+//	type = "gitlab" # or github, gitea, forgejo, bitbucket-server, gitiles, sourcehut, sourcehut-hg, cgit, gitweb
+//	token_env = "EXAMPLE_GITLAB_TOKEN"
+//	api_url = "https://git.example.com/api/v4"
+//
+//	[modules]
+//	"example.com/internal/tool" = "https://git.example.com/tools/tool"
+type config struct {
+	// Timeout for each HTTP request.
+	Timeout time.Duration `toml:"timeout"`
+	// RemoteOnly sets the default for the -r flag.
+	RemoteOnly bool `toml:"remote_only"`
+	// Names replaces the list of README file names, in order of priority.
+	Names []string `toml:"names"`
+	// Branches are default branch names to try in addition to main, trunk, and master.
+	Branches []string `toml:"branches"`
+	// CacheTTL is the lifetime of cached README files from a branch.
+	CacheTTL time.Duration `toml:"cache_ttl"`
+	// NegativeCacheTTL is the lifetime of cached "README not found" results.
+	NegativeCacheTTL time.Duration `toml:"negative_cache_ttl"`
+	// MaxSize is the maximum size of a README file in bytes.
+	MaxSize int64 `toml:"max_size"`
+	// Retries is the number of retries after transient errors and rate limiting.
+	Retries *int `toml:"retries"`
+	// MaxRetryWait is the longest time to wait for a retry.
+	MaxRetryWait time.Duration `toml:"max_retry_wait"`
+	// Hosts are self-hosted forges.
+	Hosts []hostConfig `toml:"hosts"`
+	// Modules maps module path prefixes to repository URLs, like a
+	// go-import meta tag would do, for modules whose path does not
+	// resolve to a repository. Unlike in a go-import meta tag, the
+	// URL may be the file:// URL of a local Git repository.
+	Modules map[string]string `toml:"modules"`
+}
+
+// hostConfig describes a self-hosted forge.
+type hostConfig struct {
+	Host string `toml:"host"`
+	// Type is the forge software, see forgeKinds.
+	Type string `toml:"type"`
+	// TokenEnv is the name of the environment variable that holds
+	// the access token for this host.
+	TokenEnv string `toml:"token_env"`
+	// APIURL is the base URL of the forge's API, if it is not at the
+	// default location for the forge type (for example, because the
+	// forge runs under a path prefix).
+	APIURL string `toml:"api_url"`
+}
+
+// cfg is the configuration in effect.
+var cfg config
+
+// overrides are the module path overrides from the configuration file.
+var overrides []metaImport
+
+// configPath returns the path of the configuration file:
+// $GOMAN_CONFIG if set, otherwise $XDG_CONFIG_HOME/goman/config.toml,
+// or ~/.config/goman/config.toml if XDG_CONFIG_HOME is not set.
+func configPath() string {
+	if p := os.Getenv("GOMAN_CONFIG"); p != "" {
+		return p
+	}
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "goman", "config.toml")
+}
+
+// loadConfig reads the configuration file at path.
+// A missing file is no error; loadConfig then returns the zero config.
+func loadConfig(path string) (config, error) {
+	var c config
+	if path == "" {
+		return c, nil
+	}
+	md, err := toml.DecodeFile(path, &c)
+	if os.IsNotExist(err) {
+		return config{}, nil
+	}
+	if err != nil {
+		return config{}, errors.Wrap(err, "cannot read configuration file "+path)
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		return config{}, errors.Errorf("unknown setting %q in configuration file %s", undecoded[0].String(), path)
+	}
+	return c, nil
+}
+
+// apply makes the configuration effective.
+func (c config) apply() error {
+	if c.Timeout > 0 {
+		httpClient.Timeout = c.Timeout
+	}
+	if len(c.Names) > 0 {
+		names = c.Names
+	}
+	branches = append(branches, c.Branches...)
+	if c.CacheTTL > 0 {
+		cacheTTL = c.CacheTTL
+	}
+	if c.NegativeCacheTTL > 0 {
+		negativeCacheTTL = c.NegativeCacheTTL
+	}
+	if c.MaxSize > 0 {
+		maxReadmeSize = c.MaxSize
+	}
+	if c.Retries != nil {
+		maxRetries = max(*c.Retries, 0)
+	}
+	if c.MaxRetryWait > 0 {
+		maxRetryWait = c.MaxRetryWait
+	}
+
+	for _, h := range c.Hosts {
+		if h.Host == "" || h.Type == "" {
+			return errors.New("configuration: each entry in [[hosts]] needs a host and a type")
+		}
+		if err := registerForge(h.Type, h.Host, h.APIURL); err != nil {
+			return errors.Wrap(err, "configuration")
+		}
+		if h.TokenEnv != "" {
+			hosts := []string{strings.ToLower(h.Host)}
+			if u, err := url.Parse(h.APIURL); err == nil && u.Host != "" && !strings.EqualFold(u.Host, h.Host) {
+				hosts = append(hosts, strings.ToLower(u.Host))
+			}
+			for _, host := range hosts {
+				tokenEnvs[host] = append([]string{h.TokenEnv}, tokenEnvs[host]...)
+			}
+		}
+	}
+
+	for prefix, url := range c.Modules {
+		overrides = append(overrides, metaImport{Prefix: strings.Trim(prefix, "/"), VCS: "git", RepoRoot: url, Configured: true})
+	}
+
+	cfg = c
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const testConfig = `
+timeout = "20s"
+remote_only = true
+names = ["README.md", "README.rst"]
+branches = ["develop"]
+cache_ttl = "12h"
+
+[[hosts]]
+host = "git.example.com"
+type = "gitlab"
+token_env = "EXAMPLE_TOKEN"
+
+[modules]
+"example.com/internal/tool" = "https://git.example.com/tools/tool"
+`
+
+func Test_configPath(t *testing.T) {
+	t.Setenv("GOMAN_CONFIG", "")
+	t.Setenv("XDG_CONFIG_HOME", "/xdg")
+	if got, want := configPath(), filepath.Join("/xdg", "goman", "config.toml"); got != want {
+		t.Errorf("configPath() = %v, want %v", got, want)
+	}
+	t.Setenv("GOMAN_CONFIG", "/etc/goman.toml")
+	if got := configPath(); got != "/etc/goman.toml" {
+		t.Errorf("configPath() = %v, want the value of GOMAN_CONFIG", got)
+	}
+}
+
+func Test_loadConfig(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"config.toml":  testConfig,
+		"unknown.toml": "colour = \"blue\"\n",
+		"broken.toml":  "timeout = \n",
+	})
+
+	c, err := loadConfig(filepath.Join(dir, "config.toml"))
+	if err != nil {
+		t.Fatalf("loadConfig(): %v", err)
+	}
+	want := config{
+		Timeout:    20 * time.Second,
+		RemoteOnly: true,
+		Names:      []string{"README.md", "README.rst"},
+		Branches:   []string{"develop"},
+		CacheTTL:   12 * time.Hour,
+		Hosts:      []hostConfig{{Host: "git.example.com", Type: "gitlab", TokenEnv: "EXAMPLE_TOKEN"}},
+		Modules:    map[string]string{"example.com/internal/tool": "https://git.example.com/tools/tool"},
+	}
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("loadConfig()\ngot  %+v\nwant %+v", c, want)
+	}
+
+	if _, err := loadConfig(filepath.Join(dir, "missing.toml")); err != nil {
+		t.Errorf("loadConfig() of a missing file: %v", err)
+	}
+	for _, name := range []string{"unknown.toml", "broken.toml"} {
+		if _, err := loadConfig(filepath.Join(dir, name)); err == nil {
+			t.Errorf("loadConfig(%s) returned no error", name)
+		}
+	}
+}
+
+func Test_config_apply(t *testing.T) {
+	defer func(n, b []string, f []forge, o []metaImport, c config, timeout, ttl time.Duration) {
+		names, branches, forges, overrides, cfg, httpClient.Timeout, cacheTTL = n, b, f, o, c, timeout, ttl
+	}(names, branches, forges, overrides, cfg, httpClient.Timeout, cacheTTL)
+
+	fp := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(fp, []byte(testConfig), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := loadConfig(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.apply(); err != nil {
+		t.Fatalf("apply(): %v", err)
+	}
+
+	if httpClient.Timeout != 20*time.Second {
+		t.Errorf("timeout = %v", httpClient.Timeout)
+	}
+	if cacheTTL != 12*time.Hour || negativeCacheTTL != time.Hour {
+		t.Errorf("cacheTTL = %v, negativeCacheTTL = %v", cacheTTL, negativeCacheTTL)
+	}
+	if !reflect.DeepEqual(names, []string{"README.md", "README.rst"}) {
+		t.Errorf("names = %v", names)
+	}
+	if !reflect.DeepEqual(branches, []string{"main", "trunk", "master", "develop"}) {
+		t.Errorf("branches = %v", branches)
+	}
+	if f := forgeFor("git.example.com/group/repo"); f != (gitlabForge{host: "git.example.com"}) {
+		t.Errorf("forgeFor() = %v, want the configured GitLab host", f)
+	}
+
+	verbose = new(bool)
+	repo, locs := remoteLocations("example.com/internal/tool/cmd/tool", "example.com/internal/tool")
+	if repo != (repository{Root: "git.example.com/tools/tool", URL: "https://git.example.com/tools/tool", VCS: "git", Configured: true}) {
+		t.Errorf("remoteLocations() repository = %+v, want the overridden one", repo)
+	}
+	if len(locs) == 0 || locs[0] != (location{Root: "git.example.com/tools/tool", Dir: "cmd/tool"}) {
+		t.Errorf("remoteLocations() = %v, want the overridden repository first", locs)
+	}
+
+	c.Hosts = []hostConfig{{Host: "git.example.com", Type: "svn"}}
+	if err := c.apply(); err == nil {
+		t.Errorf("apply() accepted an unknown host type")
+	}
+}
@@ -0,0 +1,394 @@
+// (C) 2017 Christoph Berger <mail@christophberger.com>. Some rights reserved.
+// Distributed under a 3-clause BSD license; see LICENSE.txt.
+
+package main
+
+import (
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/mod/semver"
+)
+
+// forge is a code hosting service that serves the raw content of the files
+// in its repositories. Forges with an API may implement readmeFinder and
+// defaultBrancher, too.
+type forge interface {
+	// match reports whether the forge is in charge of host.
+	match(host string) bool
+	// rawURL returns the URL of the raw content of file (a slash-separated
+	// path within the repository) at ref (a branch, tag, or commit ID).
+	// root is the repository root without scheme, e.g. github.com/user/repo.
+	rawURL(root, ref, file string) string
+}
+
+// fixedDepthForge is a forge whose repository paths always consist of the
+// same number of path elements, like owner/project on GitHub. On forges
+// that allow nested groups, like GitLab, the depth varies, and only the
+// go-import meta tag tells where the repository root is.
+type fixedDepthForge interface {
+	depth() int
+}
+
+// aboutPager is implemented by repository browsers that render the README of
+// the default branch on a web page of its own, like the "about" page of cgit.
+// findRemoteReadme tries this page after all raw URLs, and readmeFromHTML
+// extracts the README from it.
+type aboutPager interface {
+	aboutURL(root string) string
+}
+
+// forges is the registry of known forges. forgeFor picks the first match,
+// hence registerForge prepends new entries, so that hosts configured by
+// the user win over the built-in ones.
+var forges = []forge{
+	githubForge{host: "github.com"},
+	gitlabForge{host: "gitlab.com"},
+	sourcehutForge{host: "git.sr.ht"},
+	sourcehutForge{host: "hg.sr.ht", hg: true},
+	giteaForge{host: "codeberg.org"},
+	bitbucketForge{host: "bitbucket.org"},
+	gitilesForge{host: "googlesource.com", domain: true},
+}
+
+// forgeKinds maps the forge types that can be registered for a host
+// to their constructors. api is the base URL of the forge's API;
+// if empty, the forge derives it from the host.
+var forgeKinds = map[string]func(host, api string) forge{
+	"github":           func(host, api string) forge { return githubForge{host: host, api: api} },
+	"gitlab":           func(host, api string) forge { return gitlabForge{host: host, api: api} },
+	"sourcehut":        func(host, _ string) forge { return sourcehutForge{host: host} },
+	"sourcehut-hg":     func(host, _ string) forge { return sourcehutForge{host: host, hg: true} },
+	"gitea":            func(host, api string) forge { return giteaForge{host: host, api: api} },
+	"forgejo":          func(host, api string) forge { return giteaForge{host: host, api: api} },
+	"bitbucket-server": func(host, api string) forge { return bitbucketServerForge{host: host, api: api} },
+	"gitiles":          func(host, _ string) forge { return gitilesForge{host: host} },
+	"cgit":             func(host, _ string) forge { return cgitForge{host: host} },
+	"gitweb":           func(host, _ string) forge { return gitwebForge{host: host} },
+}
+
+// registerForge adds a host that runs a forge of the given kind,
+// for example, a self-hosted GitLab instance. api is the base URL of the
+// forge's API, if it differs from the default for the kind of forge.
+func registerForge(kind, host, api string) error {
+	newForge, ok := forgeKinds[kind]
+	if !ok {
+		return errors.Errorf("unknown forge type %q for host %s", kind, host)
+	}
+	forges = append([]forge{newForge(strings.ToLower(host), api)}, forges...)
+	return nil
+}
+
+// forgeFor returns the forge that hosts the repository at root,
+// or nil if the host is not known.
+func forgeFor(root string) forge {
+	host := hostOf(root)
+	for _, f := range forges {
+		if f.match(host) {
+			return f
+		}
+	}
+	return nil
+}
+
+// hostOf returns the host part of a scheme-less path, in lower case.
+func hostOf(p string) string {
+	host, _, _ := strings.Cut(strings.Trim(p, "/"), "/")
+	return strings.ToLower(host)
+}
+
+// repoPath returns root without the host part, e.g. user/repo.
+func repoPath(root string) string {
+	_, p, _ := strings.Cut(strings.Trim(root, "/"), "/")
+	return p
+}
+
+// githubForge is github.com, or a GitHub Enterprise server.
+type githubForge struct {
+	host string
+	api  string // base URL of the REST API; see apiBase
+}
+
+func (f githubForge) match(host string) bool {
+	return host == f.host
+}
+
+func (f githubForge) depth() int { return 2 }
+
+// rawURL returns
+// https://raw.githubusercontent.com/<user>/<repo>/<ref>/<file> for github.com, and
+// https://<host>/<user>/<repo>/raw/<ref>/<file> for GitHub Enterprise.
+func (f githubForge) rawURL(root, ref, file string) string {
+	if f.host == "github.com" {
+		return "https://" + path.Join("raw.githubusercontent.com", repoPath(root), ref, file)
+	}
+	return "https://" + path.Join(f.host, repoPath(root), "raw", ref, file)
+}
+
+// gitlabForge is gitlab.com, or a self-hosted GitLab instance.
+type gitlabForge struct {
+	host string
+	api  string // base URL of the REST API; see apiBase
+}
+
+func (f gitlabForge) match(host string) bool {
+	return host == f.host
+}
+
+// rawURL returns https://<host>/<group>/.../<repo>/-/raw/<ref>/<file>
+func (f gitlabForge) rawURL(root, ref, file string) string {
+	return "https://" + path.Join(f.host, repoPath(root), "-", "raw", ref, file)
+}
+
+// sourcehutForge is git.sr.ht or hg.sr.ht, or a self-hosted instance of
+// either. Repository paths start with the owner's name prefixed by a tilde,
+// e.g. git.sr.ht/~user/repo.
+type sourcehutForge struct {
+	host string
+	hg   bool // Mercurial repositories (hg.sr.ht) rather than Git (git.sr.ht)
+}
+
+func (f sourcehutForge) match(host string) bool {
+	return host == f.host
+}
+
+func (f sourcehutForge) depth() int { return 2 }
+
+// rawURL returns
+// https://git.sr.ht/~<user>/<repo>/blob/<ref>/<file> for Git repositories, and
+// https://hg.sr.ht/~<user>/<repo>/raw/<file>?rev=<ref> for Mercurial repositories.
+func (f sourcehutForge) rawURL(root, ref, file string) string {
+	if f.hg {
+		return "https://" + path.Join(f.host, repoPath(root), "raw", file) + "?rev=" + url.QueryEscape(ref)
+	}
+	return "https://" + path.Join(f.host, repoPath(root), "blob", ref, file)
+}
+
+// giteaForge is codeberg.org, or a self-hosted Gitea or Forgejo instance.
+type giteaForge struct {
+	host string
+	api  string // base URL of the REST API; see apiBase
+}
+
+func (f giteaForge) match(host string) bool {
+	return host == f.host
+}
+
+func (f giteaForge) depth() int { return 2 }
+
+// rawURL returns https://<host>/<owner>/<repo>/raw/<kind>/<ref>/<file>.
+// Gitea wants to know whether ref is a branch, a tag, or a commit. Commit IDs
+// and module version tags can be told by their form; anything else is
+// assumed to be a branch.
+func (f giteaForge) rawURL(root, ref, file string) string {
+	kind := "branch"
+	switch {
+	case isCommitID(ref):
+		kind = "commit"
+	case isVersionTag(ref):
+		kind = "tag"
+	}
+	return "https://" + path.Join(f.host, repoPath(root), "raw", kind, ref, file)
+}
+
+// isVersionTag reports whether ref is a module version tag, that is, a
+// complete semantic version with an optional subdirectory prefix, as gitRef
+// returns it. Shorthands like v2 are common in branch names and don't count.
+func isVersionTag(ref string) bool {
+	v := path.Base(ref)
+	return semver.IsValid(v) && semver.Canonical(v) == v
+}
+
+// isImmutableRef reports whether ref always names the same commit, which
+// makes a README at ref good for caching forever: a commit ID, or a module
+// version tag. Branches move on.
+func isImmutableRef(ref string) bool {
+	return isCommitID(ref) || isVersionTag(ref)
+}
+
+// isCommitID reports whether ref looks like a full or abbreviated
+// SHA-1 or SHA-256 commit ID, like the revision in a pseudo-version.
+func isCommitID(ref string) bool {
+	if len(ref) < 7 || len(ref) > 64 {
+		return false
+	}
+	for _, c := range ref {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// bitbucketForge is Bitbucket Cloud at bitbucket.org.
+type bitbucketForge struct {
+	host string
+}
+
+func (f bitbucketForge) match(host string) bool {
+	return host == f.host
+}
+
+func (f bitbucketForge) depth() int { return 2 }
+
+// rawURL returns https://bitbucket.org/<workspace>/<repo>/raw/<ref>/<file>
+func (f bitbucketForge) rawURL(root, ref, file string) string {
+	return "https://" + path.Join(f.host, repoPath(root), "raw", ref, file)
+}
+
+// bitbucketServerForge is a Bitbucket Server or Bitbucket Data Center instance.
+type bitbucketServerForge struct {
+	host string
+	api  string // base URL of the REST API; see apiBase
+}
+
+func (f bitbucketServerForge) match(host string) bool {
+	return host == f.host
+}
+
+// rawURL returns https://<host>/projects/<project>/repos/<repo>/raw/<file>?at=<ref>
+// for repositories in projects, and
+// https://<host>/users/<user>/repos/<repo>/raw/<file>?at=<ref>
+// for personal repositories. Branches and version tags are passed as fully
+// qualified refs, so that Bitbucket does not confuse them.
+func (f bitbucketServerForge) rawURL(root, ref, file string) string {
+	project, repo := f.repo(root)
+	u := "https://" + path.Join(f.host, projectPath(project), "repos", repo, "raw", file)
+	switch {
+	case ref == "":
+		return u
+	case isCommitID(ref):
+	case isVersionTag(ref):
+		ref = "refs/tags/" + ref
+	default:
+		ref = "refs/heads/" + ref
+	}
+	return u + "?at=" + url.QueryEscape(ref)
+}
+
+// repo splits root into the project key and the repository slug. The key
+// of a personal project is the user name prefixed by a tilde. root may be
+// a clone URL path, <host>/scm/<project>/<repo>.git, or a web URL path,
+// <host>/projects/<project>/repos/<repo>. Clone URLs have the project key
+// in lower case, but keys are upper case.
+func (f bitbucketServerForge) repo(root string) (project, repo string) {
+	p := strings.TrimSuffix(repoPath(root), ".git")
+	p = strings.TrimPrefix(p, "scm/")
+	elems := strings.Split(p, "/")
+	switch {
+	case len(elems) == 4 && elems[0] == "projects" && elems[2] == "repos":
+		project, repo = elems[1], elems[3]
+	case len(elems) == 4 && elems[0] == "users" && elems[2] == "repos":
+		project, repo = "~"+elems[1], elems[3]
+	default:
+		project, repo, _ = strings.Cut(p, "/")
+	}
+	if !strings.HasPrefix(project, "~") {
+		project = strings.ToUpper(project)
+	}
+	return project, repo
+}
+
+// projectPath returns the web URL path of a project: projects/<project>,
+// or users/<user> for personal projects.
+func projectPath(project string) string {
+	if user, ok := strings.CutPrefix(project, "~"); ok {
+		return "users/" + user
+	}
+	return "projects/" + project
+}
+
+// gitilesForge is a Gitiles server, such as go.googlesource.com, which
+// hosts the golang.org/x modules. Gitiles has no raw file view; it serves
+// files base64-encoded instead, which httpGetReadme decodes.
+type gitilesForge struct {
+	host   string
+	domain bool // the forge serves all subdomains of host, like *.googlesource.com
+}
+
+func (f gitilesForge) match(host string) bool {
+	return host == f.host || f.domain && strings.HasSuffix(host, "."+f.host)
+}
+
+// rawURL returns https://<host>/<repo>/+/<ref>/<file>?format=TEXT.
+// The ref is fully qualified; see gitilesRef.
+func (f gitilesForge) rawURL(root, ref, file string) string {
+	return "https://" + path.Join(hostOf(root), repoPath(root), "+", gitilesRef(ref), file) + "?format=TEXT"
+}
+
+// gitilesRef qualifies ref for a Gitiles URL: refs/tags/<tag> for version
+// tags, refs/heads/<branch> for branches, and commit IDs and HEAD as they
+// are. Short names would work, too, but Gitiles cannot tell where a short
+// name with slashes ends and the file path begins.
+func gitilesRef(ref string) string {
+	switch {
+	case ref == "HEAD", isCommitID(ref):
+		return ref
+	case isVersionTag(ref):
+		return "refs/tags/" + ref
+	}
+	return "refs/heads/" + ref
+}
+
+// cgitForge is a host that runs the cgit repository browser.
+type cgitForge struct {
+	host string
+}
+
+func (f cgitForge) match(host string) bool {
+	return host == f.host
+}
+
+// rawURL returns https://<host>/<repo>/plain/<file>?h=<branch> for branches,
+// and ?id=<ref> for tags and commits.
+func (f cgitForge) rawURL(root, ref, file string) string {
+	u := "https://" + path.Join(hostOf(root), repoPath(root), "plain", file)
+	switch {
+	case ref == "":
+		return u
+	case isVersionTag(ref), isCommitID(ref):
+		return u + "?id=" + url.QueryEscape(ref)
+	}
+	return u + "?h=" + url.QueryEscape(ref)
+}
+
+// aboutURL returns https://<host>/<repo>/about/
+func (f cgitForge) aboutURL(root string) string {
+	return "https://" + path.Join(hostOf(root), repoPath(root), "about") + "/"
+}
+
+// gitwebForge is a host that runs the gitweb repository browser at the root
+// of the host. The gitweb project is the repository path with .git appended.
+type gitwebForge struct {
+	host string
+}
+
+func (f gitwebForge) match(host string) bool {
+	return host == f.host
+}
+
+// rawURL returns https://<host>/?p=<project>;a=blob_plain;f=<file>;hb=<ref>
+func (f gitwebForge) rawURL(root, ref, file string) string {
+	u := "https://" + hostOf(root) + "/?p=" + gitwebProject(root) + ";a=blob_plain;f=" + file
+	if ref != "" {
+		u += ";hb=" + url.QueryEscape(ref)
+	}
+	return u
+}
+
+// aboutURL returns the project summary page, which shows the README.html
+// of the repository: https://<host>/?p=<project>;a=summary
+func (f gitwebForge) aboutURL(root string) string {
+	return "https://" + hostOf(root) + "/?p=" + gitwebProject(root) + ";a=summary"
+}
+
+// gitwebProject returns the gitweb project name of the repository at root.
+func gitwebProject(root string) string {
+	p := repoPath(root)
+	if !strings.HasSuffix(p, ".git") {
+		p += ".git"
+	}
+	return p
+}
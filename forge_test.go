@@ -0,0 +1,116 @@
+package main
+
+import "testing"
+
+func Test_forge_rawURL(t *testing.T) {
+	tests := []struct {
+		name  string
+		forge forge
+		root  string
+		ref   string
+		file  string
+		want  string
+	}{
+		{"github", githubForge{host: "github.com"}, "github.com/user/repo", "main", "README.md",
+			"https://raw.githubusercontent.com/user/repo/main/README.md"},
+		{"github subdir", githubForge{host: "github.com"}, "github.com/user/repo", "v1.2.3", "cmd/tool/README.md",
+			"https://raw.githubusercontent.com/user/repo/v1.2.3/cmd/tool/README.md"},
+		{"github submodule tag", githubForge{host: "github.com"}, "github.com/user/repo", "tools/v1.2.3", "tools/README.md",
+			"https://raw.githubusercontent.com/user/repo/tools/v1.2.3/tools/README.md"},
+		{"github enterprise", githubForge{host: "ghe.example.com"}, "ghe.example.com/user/repo", "main", "README.md",
+			"https://ghe.example.com/user/repo/raw/main/README.md"},
+		{"gitlab", gitlabForge{host: "gitlab.com"}, "gitlab.com/group/subgroup/repo", "main", "cmd/README.md",
+			"https://gitlab.com/group/subgroup/repo/-/raw/main/cmd/README.md"},
+		{"gitlab self-hosted", gitlabForge{host: "git.example.com"}, "git.example.com/group/repo", "abcdef123456", "README",
+			"https://git.example.com/group/repo/-/raw/abcdef123456/README"},
+		{"sourcehut", sourcehutForge{host: "git.sr.ht"}, "git.sr.ht/~user/repo", "master", "README.md",
+			"https://git.sr.ht/~user/repo/blob/master/README.md"},
+		{"sourcehut mercurial", sourcehutForge{host: "hg.sr.ht", hg: true}, "hg.sr.ht/~user/repo", "tools/v1.0.0", "tools/README.md",
+			"https://hg.sr.ht/~user/repo/raw/tools/README.md?rev=tools%2Fv1.0.0"},
+		{"codeberg branch", giteaForge{host: "codeberg.org"}, "codeberg.org/user/repo", "main", "README.md",
+			"https://codeberg.org/user/repo/raw/branch/main/README.md"},
+		{"codeberg tag", giteaForge{host: "codeberg.org"}, "codeberg.org/user/repo", "v1.2.3", "cmd/tool/README.md",
+			"https://codeberg.org/user/repo/raw/tag/v1.2.3/cmd/tool/README.md"},
+		{"forgejo submodule tag", giteaForge{host: "git.example.com"}, "git.example.com/user/repo", "tools/v0.3.0", "tools/README.md",
+			"https://git.example.com/user/repo/raw/tag/tools/v0.3.0/tools/README.md"},
+		{"gitea commit", giteaForge{host: "git.example.com"}, "git.example.com/user/repo", "abcdef123456", "README",
+			"https://git.example.com/user/repo/raw/commit/abcdef123456/README"},
+		{"bitbucket cloud", bitbucketForge{host: "bitbucket.org"}, "bitbucket.org/workspace/repo", "v1.2.3", "cmd/README.md",
+			"https://bitbucket.org/workspace/repo/raw/v1.2.3/cmd/README.md"},
+		{"bitbucket server clone path", bitbucketServerForge{host: "bb.example.com"}, "bb.example.com/scm/tools/repo.git", "main", "README.md",
+			"https://bb.example.com/projects/TOOLS/repos/repo/raw/README.md?at=refs%2Fheads%2Fmain"},
+		{"bitbucket server tag", bitbucketServerForge{host: "bb.example.com"}, "bb.example.com/tools/repo", "sub/v1.0.0", "sub/README.md",
+			"https://bb.example.com/projects/TOOLS/repos/repo/raw/sub/README.md?at=refs%2Ftags%2Fsub%2Fv1.0.0"},
+		{"bitbucket server personal", bitbucketServerForge{host: "bb.example.com"}, "bb.example.com/scm/~jdoe/repo.git", "abcdef123456", "README.md",
+			"https://bb.example.com/users/jdoe/repos/repo/raw/README.md?at=abcdef123456"},
+		{"bitbucket server web path", bitbucketServerForge{host: "bb.example.com"}, "bb.example.com/projects/TOOLS/repos/repo", "", "README.md",
+			"https://bb.example.com/projects/TOOLS/repos/repo/raw/README.md"},
+		{"gitiles tag", gitilesForge{host: "googlesource.com", domain: true}, "go.googlesource.com/tools", "gopls/v0.16.0", "gopls/README.md",
+			"https://go.googlesource.com/tools/+/refs/tags/gopls/v0.16.0/gopls/README.md?format=TEXT"},
+		{"gitiles head", gitilesForge{host: "googlesource.com", domain: true}, "go.googlesource.com/tools", "HEAD", "README.md",
+			"https://go.googlesource.com/tools/+/HEAD/README.md?format=TEXT"},
+		{"gitiles branch", gitilesForge{host: "gerrit.example.com"}, "gerrit.example.com/a/b/repo", "release/1.x", "README.md",
+			"https://gerrit.example.com/a/b/repo/+/refs/heads/release/1.x/README.md?format=TEXT"},
+		{"gitiles commit", gitilesForge{host: "gerrit.example.com"}, "gerrit.example.com/repo", "0123456789ab", "README.md",
+			"https://gerrit.example.com/repo/+/0123456789ab/README.md?format=TEXT"},
+		{"cgit branch", cgitForge{host: "git.example.com"}, "git.example.com/tool", "main", "cmd/README.md",
+			"https://git.example.com/tool/plain/cmd/README.md?h=main"},
+		{"cgit tag", cgitForge{host: "git.example.com"}, "git.example.com/tool", "v1.2.3", "README.md",
+			"https://git.example.com/tool/plain/README.md?id=v1.2.3"},
+		{"gitweb commit", gitwebForge{host: "git.example.com"}, "git.example.com/tools/tool", "abcdef123456", "README",
+			"https://git.example.com/?p=tools/tool.git;a=blob_plain;f=README;hb=abcdef123456"},
+		{"gitea branch that looks like neither", giteaForge{host: "git.example.com"}, "git.example.com/user/repo", "release/v2", "README",
+			"https://git.example.com/user/repo/raw/branch/release/v2/README"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.forge.rawURL(tt.root, tt.ref, tt.file); got != tt.want {
+				t.Errorf("rawURL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_forgeFor(t *testing.T) {
+	defer func(f []forge) { forges = f }(forges)
+	if err := registerForge("gitlab", "Git.Example.com", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := registerForge("forgejo", "Forgejo.example.com", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := registerForge("bitbucket-server", "bb.example.com", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := registerForge("gogs", "gogs.example.com", ""); err == nil {
+		t.Errorf("registerForge() accepted an unknown forge type")
+	}
+
+	tests := []struct {
+		root string
+		want forge
+	}{
+		{"github.com/user/repo", githubForge{host: "github.com"}},
+		{"GitHub.com/User/Repo", githubForge{host: "github.com"}},
+		{"gitlab.com/group/subgroup/repo", gitlabForge{host: "gitlab.com"}},
+		{"git.sr.ht/~user/repo", sourcehutForge{host: "git.sr.ht"}},
+		{"hg.sr.ht/~user/repo", sourcehutForge{host: "hg.sr.ht", hg: true}},
+		{"git.example.com/group/repo", gitlabForge{host: "git.example.com"}},
+		{"codeberg.org/user/repo", giteaForge{host: "codeberg.org"}},
+		{"forgejo.example.com/user/repo", giteaForge{host: "forgejo.example.com"}},
+		{"bitbucket.org/workspace/repo", bitbucketForge{host: "bitbucket.org"}},
+		{"bb.example.com/scm/tools/repo.git", bitbucketServerForge{host: "bb.example.com"}},
+		{"go.googlesource.com/tools", gitilesForge{host: "googlesource.com", domain: true}},
+		{"chromium.googlesource.com/chromium/src", gitilesForge{host: "googlesource.com", domain: true}},
+		{"notgooglesource.com/repo", nil},
+		{"npf.io/gorram", nil},
+		{"github.com.example.com/user/repo", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.root, func(t *testing.T) {
+			if got := forgeFor(tt.root); got != tt.want {
+				t.Errorf("forgeFor(%q) = %v, want %v", tt.root, got, tt.want)
+			}
+		})
+	}
+}
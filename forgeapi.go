@@ -0,0 +1,556 @@
+// (C) 2017 Christoph Berger <mail@christophberger.com>. Some rights reserved.
+// Distributed under a 3-clause BSD license; see LICENSE.txt.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Forges with an API can do better than guessing README URLs.
+// A forge implements the interfaces below for what its API offers.
+
+// readmeFinder is a forge with an API that knows the README of a directory,
+// whatever its file name.
+type readmeFinder interface {
+	// readmeURL returns the URL of the raw README file in directory dir
+	// (slash-separated, "" for the root) of the repository at root, at ref.
+	// If ref is empty, readmeURL looks at the default branch.
+	readmeURL(ctx context.Context, root, ref, dir string) (string, error)
+}
+
+// defaultBrancher is a forge with an API that knows the default branch of a repository.
+type defaultBrancher interface {
+	defaultBranch(ctx context.Context, root string) (string, error)
+}
+
+// findAPIReadme is a helper function for findRemoteReadme. It asks the APIs
+// of the forges that host locs for the README, and returns the README of the
+// first location that has one. All locations are requested concurrently.
+func findAPIReadme(locs []location, ref string) (readme httpReadme, readmeURL string, err error) {
+
+	type apiLocation struct {
+		location
+		finder readmeFinder
+	}
+	var apiLocs []apiLocation
+	for _, loc := range locs {
+		if f, ok := forgeFor(loc.Root).(readmeFinder); ok {
+			apiLocs = append(apiLocs, apiLocation{loc, f})
+		}
+	}
+	if len(apiLocs) == 0 {
+		return httpReadme{}, "", errors.New("no forge API for any of the locations")
+	}
+
+	results := make([]httpReadme, len(apiLocs))
+	urls := make([]string, len(apiLocs))
+	var limits hostLimits
+	i, _, err := firstSuccess(context.Background(), len(apiLocs), maxParallelRequests,
+		func(ctx context.Context, i int) ([]byte, error) {
+			loc := apiLocs[i]
+			host, _, _ := strings.Cut(loc.Root, "/")
+			err := limits.do(ctx, host, func(ctx context.Context) error {
+				u, err := loc.finder.readmeURL(ctx, loc.Root, ref, loc.Dir)
+				if err != nil {
+					return err
+				}
+				results[i], err = httpGetReadme(ctx, u, nil)
+				urls[i] = u
+				return err
+			})
+			return results[i].Content, err
+		})
+	if rl := limits.err(); err != nil && rl != nil {
+		return httpReadme{}, "", errors.Wrap(rl, "forge API")
+	}
+	if err != nil {
+		return httpReadme{}, "", errors.Wrap(err, "forge API")
+	}
+	return results[i], urls[i], nil
+}
+
+// defaultBranches is a helper function for findRemoteReadme. It asks the APIs
+// of the forges that host locs for the default branches of the repositories.
+// Repositories whose default branch is unknown are missing from the result.
+func defaultBranches(locs []location) map[string]string {
+	branches := map[string]string{}
+	seen := map[string]bool{}
+	for _, loc := range locs {
+		if seen[loc.Root] {
+			continue
+		}
+		seen[loc.Root] = true
+		f, ok := forgeFor(loc.Root).(defaultBrancher)
+		if !ok {
+			continue
+		}
+		if b, err := f.defaultBranch(context.Background(), loc.Root); err == nil && b != "" {
+			branches[loc.Root] = b
+		}
+	}
+	return branches
+}
+
+// apiGet sends a GET request to a forge API and decodes the JSON response into v.
+// If the API responds with "404 Not Found", the error is errNotFound.
+func apiGet(ctx context.Context, apiURL, accept string, v any) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+	if err != nil {
+		return errors.Wrap(err, "invalid API URL "+apiURL)
+	}
+	request.Header.Set("Accept", accept)
+
+	response, err := doWithRetry(httpClient, request)
+	if err != nil {
+		return errors.Wrap(err, "API request failed")
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return errNotFound{"API request returned " + response.Status + " for URL " + apiURL}
+	default:
+		return errors.New("API request returned " + response.Status + " for URL " + apiURL)
+	}
+
+	// API responses that list or describe files are small; the limit
+	// protects against misbehaving servers.
+	body := bufio.NewReader(io.LimitReader(response.Body, maxReadmeSize))
+	// Gitiles prefixes JSON with a line that prevents cross-site script inclusion.
+	if prefix, _ := body.Peek(len(xssiPrefix)); string(prefix) == xssiPrefix {
+		_, _ = body.ReadString('\n')
+	}
+	err = json.NewDecoder(body).Decode(v)
+	return errors.Wrap(err, "invalid API response from "+apiURL)
+}
+
+const xssiPrefix = ")]}'"
+
+// pickReadme returns the README among the files of a directory, or "" if
+// there is none. Names from the list of README names come first, in the
+// order of the list. Other files named README with any case and extension
+// follow, Markdown first.
+func pickReadme(files []string) string {
+	for _, name := range names {
+		for _, f := range files {
+			if f == name {
+				return f
+			}
+		}
+	}
+
+	best, bestRank := "", 0
+	for _, f := range files {
+		base, ext, _ := strings.Cut(f, ".")
+		if !strings.EqualFold(base, "readme") {
+			continue
+		}
+		rank := 1
+		switch strings.ToLower(ext) {
+		case "md", "markdown":
+			rank = 4
+		case "", "txt":
+			rank = 3
+		case "rst", "adoc", "org":
+			rank = 2
+		}
+		if rank > bestRank {
+			best, bestRank = f, rank
+		}
+	}
+	return best
+}
+
+// apiBase returns the base URL of the REST API:
+// https://api.github.com for github.com, and
+// https://<host>/api/v3 for GitHub Enterprise,
+// unless the configuration file sets a different URL.
+func (f githubForge) apiBase() string {
+	switch {
+	case f.api != "":
+		return strings.TrimRight(f.api, "/")
+	case f.host == "github.com":
+		return "https://api.github.com"
+	}
+	return "https://" + f.host + "/api/v3"
+}
+
+const githubJSON = "application/vnd.github+json"
+
+// readmeURL uses the endpoint /repos/<owner>/<repo>/readme/<dir>.
+// GitHub finds the README in the root directory also in .github/ and docs/.
+func (f githubForge) readmeURL(ctx context.Context, root, ref, dir string) (string, error) {
+	u := f.apiBase() + "/repos/" + repoPath(root) + "/readme"
+	if dir != "" {
+		u += "/" + escapePath(dir)
+	}
+	if ref != "" {
+		u += "?ref=" + url.QueryEscape(ref)
+	}
+
+	var readme struct {
+		DownloadURL string `json:"download_url"`
+	}
+	if err := apiGet(ctx, u, githubJSON, &readme); err != nil {
+		return "", err
+	}
+	if readme.DownloadURL == "" {
+		return "", errors.New("no download URL for the README in " + u)
+	}
+	// The download URL of a private repository carries a temporary token,
+	// which must not end up in the cache or on the screen. authTransport
+	// authenticates the request anyway.
+	d, err := url.Parse(readme.DownloadURL)
+	if err != nil {
+		return "", errors.Wrap(err, "invalid download URL for the README in "+u)
+	}
+	d.RawQuery = ""
+	return d.String(), nil
+}
+
+// defaultBranch uses the endpoint /repos/<owner>/<repo>.
+func (f githubForge) defaultBranch(ctx context.Context, root string) (string, error) {
+	var repo struct {
+		DefaultBranch string `json:"default_branch"`
+	}
+	err := apiGet(ctx, f.apiBase()+"/repos/"+repoPath(root), githubJSON, &repo)
+	return repo.DefaultBranch, err
+}
+
+// apiBase returns the base URL of the REST API, https://<host>/api/v4,
+// unless the configuration file sets a different URL.
+func (f gitlabForge) apiBase() string {
+	if f.api != "" {
+		return strings.TrimRight(f.api, "/")
+	}
+	return "https://" + f.host + "/api/v4"
+}
+
+// project returns the API URL of the project at root. GitLab identifies
+// projects by their URL-encoded path, e.g. group%2Fsubgroup%2Frepo.
+func (f gitlabForge) project(root string) string {
+	return f.apiBase() + "/projects/" + url.PathEscape(repoPath(root))
+}
+
+// readmeURL lists directory dir with the repository tree API, picks the
+// README, and returns the URL of the raw file from the repository files API.
+func (f gitlabForge) readmeURL(ctx context.Context, root, ref, dir string) (string, error) {
+	q := url.Values{"per_page": {"100"}}
+	if dir != "" {
+		q.Set("path", dir)
+	}
+	if ref != "" {
+		q.Set("ref", ref)
+	}
+
+	var tree []struct {
+		Name string `json:"name"`
+		Type string `json:"type"`
+	}
+	if err := apiGet(ctx, f.project(root)+"/repository/tree?"+q.Encode(), "application/json", &tree); err != nil {
+		return "", err
+	}
+	var files []string
+	for _, e := range tree {
+		if e.Type == "blob" {
+			files = append(files, e.Name)
+		}
+	}
+	name := pickReadme(files)
+	if name == "" {
+		return "", errNotFound{"no README in " + path.Join(root, dir)}
+	}
+
+	if ref == "" {
+		ref = "HEAD"
+	}
+	return f.project(root) + "/repository/files/" + url.PathEscape(path.Join(dir, name)) + "/raw?ref=" + url.QueryEscape(ref), nil
+}
+
+// defaultBranch uses the endpoint /projects/<id>.
+func (f gitlabForge) defaultBranch(ctx context.Context, root string) (string, error) {
+	var project struct {
+		DefaultBranch string `json:"default_branch"`
+	}
+	err := apiGet(ctx, f.project(root), "application/json", &project)
+	return project.DefaultBranch, err
+}
+
+// apiBase returns the base URL of the REST API, https://<host>/api/v1,
+// unless the configuration file sets a different URL.
+func (f giteaForge) apiBase() string {
+	if f.api != "" {
+		return strings.TrimRight(f.api, "/")
+	}
+	return "https://" + f.host + "/api/v1"
+}
+
+// readmeURL lists directory dir with the contents API, picks the README,
+// and returns its download URL.
+func (f giteaForge) readmeURL(ctx context.Context, root, ref, dir string) (string, error) {
+	u := f.apiBase() + "/repos/" + repoPath(root) + "/contents"
+	if dir != "" {
+		u += "/" + escapePath(dir)
+	}
+	if ref != "" {
+		u += "?ref=" + url.QueryEscape(ref)
+	}
+
+	var contents []struct {
+		Name        string `json:"name"`
+		Type        string `json:"type"`
+		DownloadURL string `json:"download_url"`
+	}
+	if err := apiGet(ctx, u, "application/json", &contents); err != nil {
+		return "", err
+	}
+	var files []string
+	downloads := map[string]string{}
+	for _, c := range contents {
+		if c.Type == "file" {
+			files = append(files, c.Name)
+			downloads[c.Name] = c.DownloadURL
+		}
+	}
+	name := pickReadme(files)
+	if name == "" {
+		return "", errNotFound{"no README in " + path.Join(root, dir)}
+	}
+	if downloads[name] == "" {
+		return "", errors.New("no download URL for the README in " + u)
+	}
+	return downloads[name], nil
+}
+
+// defaultBranch uses the endpoint /repos/<owner>/<repo>.
+func (f giteaForge) defaultBranch(ctx context.Context, root string) (string, error) {
+	var repo struct {
+		DefaultBranch string `json:"default_branch"`
+	}
+	err := apiGet(ctx, f.apiBase()+"/repos/"+repoPath(root), "application/json", &repo)
+	return repo.DefaultBranch, err
+}
+
+// defaultBranch of a Mercurial repository is the branch named "default".
+// For Git repositories, the sr.ht GraphQL API would need an access token,
+// so defaultBranch asks the Git server instead; see gitDefaultBranch.
+func (f sourcehutForge) defaultBranch(ctx context.Context, root string) (string, error) {
+	if f.hg {
+		return "default", nil
+	}
+	return gitDefaultBranch(ctx, "https://"+path.Join(f.host, repoPath(root)))
+}
+
+// gitDefaultBranch returns the branch that HEAD points to in the Git
+// repository at repoURL. It requests the ref advertisement of the smart HTTP
+// protocol, which is what "git clone" starts with, and looks for the
+// capability symref=HEAD:refs/heads/<branch>.
+func gitDefaultBranch(ctx context.Context, repoURL string) (string, error) {
+	u := repoURL + "/info/refs?service=git-upload-pack"
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "invalid repository URL "+repoURL)
+	}
+
+	response, err := doWithRetry(httpClient, request)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot list the refs of "+repoURL)
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "", errNotFound{"ref advertisement returned " + response.Status + " for URL " + u}
+	default:
+		return "", errors.New("ref advertisement returned " + response.Status + " for URL " + u)
+	}
+
+	// The capabilities follow the first ref, so a few kilobytes suffice.
+	adv, err := io.ReadAll(io.LimitReader(response.Body, 64<<10))
+	if err != nil {
+		return "", errors.Wrap(err, "cannot read the refs of "+repoURL)
+	}
+	const symref = "symref=HEAD:refs/heads/"
+	i := bytes.Index(adv, []byte(symref))
+	if i < 0 {
+		return "", errors.New("no default branch in the refs of " + repoURL)
+	}
+	branch := adv[i+len(symref):]
+	if end := bytes.IndexAny(branch, " \x00\n"); end >= 0 {
+		branch = branch[:end]
+	}
+	return string(branch), nil
+}
+
+// apiBase returns the base URL of the REST API, https://api.bitbucket.org/2.0.
+func (f bitbucketForge) apiBase() string {
+	return "https://api." + f.host + "/2.0"
+}
+
+// readmeURL lists directory dir with the source API, picks the README, and
+// returns the URL of the raw file from the same API. The source API needs a
+// ref, so readmeURL looks up the default branch if ref is empty.
+func (f bitbucketForge) readmeURL(ctx context.Context, root, ref, dir string) (string, error) {
+	if ref == "" {
+		var err error
+		if ref, err = f.defaultBranch(ctx, root); err != nil {
+			return "", err
+		}
+	}
+	src := f.apiBase() + "/repositories/" + repoPath(root) + "/src/" + url.PathEscape(ref) + "/"
+	if dir != "" {
+		src += escapePath(dir) + "/"
+	}
+
+	var listing struct {
+		Values []struct {
+			Path string `json:"path"`
+			Type string `json:"type"`
+		} `json:"values"`
+	}
+	if err := apiGet(ctx, src+"?pagelen=100", "application/json", &listing); err != nil {
+		return "", err
+	}
+	var files []string
+	for _, v := range listing.Values {
+		if v.Type == "commit_file" {
+			files = append(files, path.Base(v.Path))
+		}
+	}
+	name := pickReadme(files)
+	if name == "" {
+		return "", errNotFound{"no README in " + path.Join(root, dir)}
+	}
+	return src + url.PathEscape(name), nil
+}
+
+// defaultBranch uses the endpoint /repositories/<workspace>/<repo>.
+func (f bitbucketForge) defaultBranch(ctx context.Context, root string) (string, error) {
+	var repo struct {
+		MainBranch struct {
+			Name string `json:"name"`
+		} `json:"mainbranch"`
+	}
+	err := apiGet(ctx, f.apiBase()+"/repositories/"+repoPath(root), "application/json", &repo)
+	return repo.MainBranch.Name, err
+}
+
+// apiBase returns the base URL of the REST API, https://<host>/rest/api/1.0,
+// unless the configuration file sets a different URL.
+func (f bitbucketServerForge) apiBase() string {
+	if f.api != "" {
+		return strings.TrimRight(f.api, "/")
+	}
+	return "https://" + f.host + "/rest/api/1.0"
+}
+
+// apiRepo returns the API URL of the repository at root.
+func (f bitbucketServerForge) apiRepo(root string) string {
+	project, repo := f.repo(root)
+	return f.apiBase() + "/projects/" + url.PathEscape(project) + "/repos/" + url.PathEscape(repo)
+}
+
+// readmeURL lists directory dir with the browse API, picks the README,
+// and returns its raw URL.
+func (f bitbucketServerForge) readmeURL(ctx context.Context, root, ref, dir string) (string, error) {
+	u := f.apiRepo(root) + "/browse"
+	if dir != "" {
+		u += "/" + escapePath(dir)
+	}
+	q := url.Values{"limit": {"1000"}}
+	if ref != "" {
+		q.Set("at", ref)
+	}
+
+	var listing struct {
+		Children struct {
+			Values []struct {
+				Path struct {
+					Name string `json:"name"`
+				} `json:"path"`
+				Type string `json:"type"`
+			} `json:"values"`
+		} `json:"children"`
+	}
+	if err := apiGet(ctx, u+"?"+q.Encode(), "application/json", &listing); err != nil {
+		return "", err
+	}
+	var files []string
+	for _, v := range listing.Children.Values {
+		if v.Type == "FILE" {
+			files = append(files, v.Path.Name)
+		}
+	}
+	name := pickReadme(files)
+	if name == "" {
+		return "", errNotFound{"no README in " + path.Join(root, dir)}
+	}
+	return f.rawURL(root, ref, path.Join(dir, name)), nil
+}
+
+// defaultBranch uses the endpoint /projects/<project>/repos/<repo>/default-branch.
+func (f bitbucketServerForge) defaultBranch(ctx context.Context, root string) (string, error) {
+	var branch struct {
+		DisplayID string `json:"displayId"`
+	}
+	err := apiGet(ctx, f.apiRepo(root)+"/default-branch", "application/json", &branch)
+	return branch.DisplayID, err
+}
+
+// readmeURL lists directory dir in the JSON format of Gitiles, picks the
+// README, and returns the URL of the base64-encoded file.
+func (f gitilesForge) readmeURL(ctx context.Context, root, ref, dir string) (string, error) {
+	if ref == "" {
+		ref = "HEAD"
+	}
+	u := "https://" + path.Join(hostOf(root), repoPath(root), "+", gitilesRef(ref), dir) + "/?format=JSON"
+
+	var tree struct {
+		Entries []struct {
+			Name string `json:"name"`
+			Type string `json:"type"`
+		} `json:"entries"`
+	}
+	if err := apiGet(ctx, u, "application/json", &tree); err != nil {
+		return "", err
+	}
+	var files []string
+	for _, e := range tree.Entries {
+		if e.Type == "blob" {
+			files = append(files, e.Name)
+		}
+	}
+	name := pickReadme(files)
+	if name == "" {
+		return "", errNotFound{"no README in " + path.Join(root, dir)}
+	}
+	return f.rawURL(root, ref, path.Join(dir, name)), nil
+}
+
+// defaultBranch returns HEAD, which Gitiles resolves to the default branch
+// by itself.
+func (f gitilesForge) defaultBranch(ctx context.Context, root string) (string, error) {
+	return "HEAD", nil
+}
+
+// escapePath escapes the elements of a slash-separated path for use in a URL.
+func escapePath(p string) string {
+	elems := strings.Split(p, "/")
+	for i, e := range elems {
+		elems[i] = url.PathEscape(e)
+	}
+	return strings.Join(elems, "/")
+}
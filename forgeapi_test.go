@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// toServer sends all requests, whatever the host, to a test server.
+type toServer struct {
+	url *url.URL
+}
+
+func (t toServer) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.URL.Scheme, r.URL.Host = t.url.Scheme, t.url.Host
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func Test_pickReadme(t *testing.T) {
+	tests := []struct {
+		files []string
+		want  string
+	}{
+		{[]string{"main.go", "README", "README.md"}, "README.md"},
+		{[]string{"main.go", "readme.rst", "Readme.md"}, "Readme.md"},
+		{[]string{"README.rst", "README.txt"}, "README.txt"},
+		{[]string{"README.rst", "LICENSE"}, "README.rst"},
+		{[]string{"README.de.md", "readme-old", "go.mod"}, "README.de.md"},
+		{[]string{"main.go", "READ_ME"}, ""},
+	}
+	for _, tt := range tests {
+		if got := pickReadme(tt.files); got != tt.want {
+			t.Errorf("pickReadme(%v) = %q, want %q", tt.files, got, tt.want)
+		}
+	}
+}
+
+// forgeAPIServer mimics the REST APIs of a GitHub Enterprise server at
+// ghe.example.com/api/v3, a GitLab server at gl.example.com/api/v4,
+// Codeberg at codeberg.org/api/v1, Bitbucket Cloud at api.bitbucket.org/2.0,
+// a Bitbucket Server at bb.example.com/rest/api/1.0, and Gitiles at
+// go.googlesource.com, as well as the Git smart HTTP protocol and the
+// raw files of git.sr.ht and hg.sr.ht.
+// The responses are trimmed down versions of real responses.
+func forgeAPIServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		switch r.Host + r.URL.RequestURI() {
+		case "ghe.example.com/api/v3/repos/user/repo/readme/cmd/tool?ref=v1.2.0":
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"message":"Not Found","documentation_url":"https://docs.github.com/rest/repos/contents#get-a-repository-readme-for-a-directory","status":"404"}`))
+		case "ghe.example.com/api/v3/repos/user/repo/readme?ref=v1.2.0":
+			_, _ = w.Write([]byte(`{"name":"README.rst","path":"docs/README.rst","sha":"3d21ec53a331a6f037a91c368710b99387d012c1","size":17,` +
+				`"url":"https://ghe.example.com/api/v3/repos/user/repo/contents/docs/README.rst?ref=v1.2.0",` +
+				`"download_url":"https://ghe.example.com/user/repo/raw/v1.2.0/docs/README.rst","type":"file","encoding":"base64"}`))
+		case "ghe.example.com/user/repo/raw/v1.2.0/docs/README.rst":
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = w.Write([]byte("Tool\n====\n"))
+		case "ghe.example.com/api/v3/repos/user/private/readme":
+			_, _ = w.Write([]byte(`{"name":"README.md","path":"README.md","sha":"5f2b1ac1b1d67a9a3fa9f0c1f5c5e1d0c4b9e6a2","size":10,` +
+				`"download_url":"https://ghe.example.com/user/private/raw/main/README.md?token=GHSAT0AAAAAACXYZ","type":"file","encoding":"base64"}`))
+		case "ghe.example.com/user/private/raw/main/README.md", "ghe.example.com/user/private/raw/main/README.md?token=GHSAT0AAAAAACXYZ":
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = w.Write([]byte("# Private\n"))
+
+		case "gl.example.com/api/v4/projects/group%2Fsub%2Frepo/repository/tree?path=cmd%2Ftool&per_page=100":
+			_, _ = w.Write([]byte(`[{"id":"a1e8f8d745cc87e3a9248358d9352bb7f9a0aeba","name":"main.go","type":"blob","path":"cmd/tool/main.go","mode":"100644"},` +
+				`{"id":"4535904260b1082e14f867f7a24fd8c21495bde3","name":"Readme.markdown","type":"blob","path":"cmd/tool/Readme.markdown","mode":"100644"},` +
+				`{"id":"b5c57d9d3d1ab4fa06da21a0a8cbe3e6ff2fcb8c","name":"readme","type":"tree","path":"cmd/tool/readme","mode":"040000"}]`))
+		case "gl.example.com/api/v4/projects/group%2Fsub%2Frepo/repository/files/cmd%2Ftool%2FReadme.markdown/raw?ref=HEAD":
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			_, _ = w.Write([]byte("# Tool\n"))
+
+		case "gl.example.com/api/v4/projects/other%2Frepo/repository/tree?per_page=100":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "gl.example.com/api/v4/projects/other%2Frepo":
+			_, _ = w.Write([]byte(`{"id":42,"path_with_namespace":"other/repo","default_branch":"develop","visibility":"public"}`))
+		case "gl.example.com/other/repo/-/raw/develop/README.md":
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			_, _ = w.Write([]byte("# Other\n"))
+
+		case "codeberg.org/api/v1/repos/user/repo/contents/cmd/tool?ref=v0.4.1":
+			_, _ = w.Write([]byte(`[{"name":"main.go","path":"cmd/tool/main.go","sha":"7f5ab6e0a5f2c2e2d6b1b3c1e8a0d4c1f0e2a9b3","type":"file","size":312,` +
+				`"download_url":"https://codeberg.org/user/repo/raw/tag/v0.4.1/cmd/tool/main.go"},` +
+				`{"name":"README.md","path":"cmd/tool/README.md","sha":"1c9a3f4e07a9d8c3b2a1e6f5d4c3b2a1e0f9d8c7","type":"file","size":9,` +
+				`"download_url":"https://codeberg.org/user/repo/raw/tag/v0.4.1/cmd/tool/README.md"},` +
+				`{"name":"docs","path":"cmd/tool/docs","sha":"e4d3c2b1a0f9e8d7c6b5a4f3e2d1c0b9a8f7e6d5","type":"dir","size":0,"download_url":null}]`))
+		case "codeberg.org/user/repo/raw/tag/v0.4.1/cmd/tool/README.md":
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			_, _ = w.Write([]byte("# Codeberg tool\n"))
+
+		case "codeberg.org/api/v1/repos/user/empty/contents":
+			_, _ = w.Write([]byte(`[{"name":"LICENSE","path":"LICENSE","type":"file","size":1067,"download_url":"https://codeberg.org/user/empty/raw/branch/trunk/LICENSE"}]`))
+		case "codeberg.org/api/v1/repos/user/empty":
+			_, _ = w.Write([]byte(`{"id":1234,"full_name":"user/empty","default_branch":"trunk","private":false}`))
+		case "codeberg.org/user/empty/raw/branch/trunk/README":
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			_, _ = w.Write([]byte("Empty\n"))
+
+		case "git.sr.ht/~user/repo/info/refs?service=git-upload-pack":
+			w.Header().Set("Content-Type", "application/x-git-upload-pack-advertisement")
+			_, _ = w.Write([]byte("001e# service=git-upload-pack\n0000" +
+				"01492b0e5c3f1d7a9e8b6c4d2f0a1e3b5c7d9f8e6a4b HEAD\x00multi_ack thin-pack side-band side-band-64k ofs-delta shallow deepen-since deepen-not " +
+				"deepen-relative no-progress include-tag multi_ack_detailed allow-tip-sha1-in-want allow-reachable-sha1-in-want no-done " +
+				"symref=HEAD:refs/heads/develop filter object-format=sha1 agent=git/2.45.2\n" +
+				"00402b0e5c3f1d7a9e8b6c4d2f0a1e3b5c7d9f8e6a4b refs/heads/develop\n" +
+				"003e9c1d4e7f0a2b5c8d1e4f7a0b3c6d9e2f5a8b1c4d refs/tags/v0.1.0\n0000"))
+		case "git.sr.ht/~user/repo/blob/develop/cmd/tool/README.md":
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = w.Write([]byte("# sr.ht tool\n"))
+		case "hg.sr.ht/~user/repo/raw/README.md?rev=default":
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = w.Write([]byte("# hg.sr.ht\n"))
+
+		case "api.bitbucket.org/2.0/repositories/vendor/tool":
+			_, _ = w.Write([]byte(`{"type":"repository","full_name":"vendor/tool","name":"tool","is_private":false,"scm":"git",` +
+				`"mainbranch":{"type":"branch","name":"develop"}}`))
+		case "api.bitbucket.org/2.0/repositories/vendor/tool/src/develop/cmd/tool/?pagelen=100":
+			_, _ = w.Write([]byte(`{"pagelen":100,"page":1,"values":[` +
+				`{"path":"cmd/tool/main.go","type":"commit_file","size":845,"mimetype":"text/x-go","escaped_path":"cmd/tool/main.go"},` +
+				`{"path":"cmd/tool/README","type":"commit_file","size":7,"mimetype":null,"escaped_path":"cmd/tool/README"},` +
+				`{"path":"cmd/tool/readme.md","type":"commit_directory","escaped_path":"cmd/tool/readme.md"}]}`))
+		case "api.bitbucket.org/2.0/repositories/vendor/tool/src/develop/cmd/tool/README":
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = w.Write([]byte("Vendor\n"))
+
+		case "bb.example.com/rest/api/1.0/projects/TOOLS/repos/tool/browse/cmd/tool?at=v1.0.0&limit=1000":
+			_, _ = w.Write([]byte(`{"path":{"components":["cmd","tool"],"name":"tool","toString":"cmd/tool"},"revision":"v1.0.0",` +
+				`"children":{"size":2,"limit":1000,"isLastPage":true,"start":0,"values":[` +
+				`{"path":{"components":["README.md"],"name":"README.md","extension":"md","toString":"README.md"},"contentId":"c8d5b7a3e2f1","type":"FILE","size":11},` +
+				`{"path":{"components":["main.go"],"name":"main.go","extension":"go","toString":"main.go"},"contentId":"f1e2d3c4b5a6","type":"FILE","size":512}]}}`))
+		case "bb.example.com/projects/TOOLS/repos/tool/raw/cmd/tool/README.md?at=refs%2Ftags%2Fv1.0.0":
+			w.Header().Set("Content-Type", "text/plain;charset=UTF-8")
+			_, _ = w.Write([]byte("# Internal\n"))
+
+		case "bb.example.com/rest/api/1.0/projects/~jdoe/repos/old/browse?limit=1000":
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"errors":[{"context":null,"message":"Authentication failed. Please check your credentials and try again.","exceptionName":"com.atlassian.bitbucket.auth.IncorrectPasswordAuthenticationException"}]}`))
+		case "bb.example.com/rest/api/1.0/projects/~jdoe/repos/old/default-branch":
+			_, _ = w.Write([]byte(`{"id":"refs/heads/trunk","displayId":"trunk","type":"BRANCH","latestCommit":"8d51122def5632836d1cb1026e879069e10a1e13","isDefault":true}`))
+		case "bb.example.com/users/jdoe/repos/old/raw/README.md?at=refs%2Fheads%2Ftrunk":
+			w.Header().Set("Content-Type", "text/plain;charset=UTF-8")
+			_, _ = w.Write([]byte("# Old\n"))
+
+		case "go.googlesource.com/tools/+/refs/tags/gopls/v0.16.0/gopls/?format=JSON":
+			_, _ = w.Write([]byte(")]}'\n" + `{"id":"5d3a4b2c1e0f9a8b7c6d5e4f3a2b1c0d9e8f7a6b","entries":[` +
+				`{"mode":33188,"type":"blob","id":"8f2e1d0c9b8a7f6e5d4c3b2a1f0e9d8c7b6a5f4e","name":"README.md"},` +
+				`{"mode":16384,"type":"tree","id":"1a2b3c4d5e6f7a8b9c0d1e2f3a4b5c6d7e8f9a0b","name":"doc"},` +
+				`{"mode":33188,"type":"blob","id":"0f9e8d7c6b5a4f3e2d1c0b9a8f7e6d5c4b3a2f1e","name":"go.mod"}]}`))
+		case "go.googlesource.com/tools/+/refs/tags/gopls/v0.16.0/gopls/README.md?format=TEXT":
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Header().Set("X-FYI-Content-Encoding", "base64")
+			w.Header().Set("X-FYI-Content-Type", "text/plain")
+			_, _ = w.Write([]byte("IyBnb3BscwoKYGdvcGxzYCBpcyB0aGUgR28gbGFuZ3VhZ2Ugc2VydmVyLgo="))
+
+		default:
+			t.Logf("not found: %s%s", r.Host, r.URL.RequestURI())
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func Test_gitDefaultBranch(t *testing.T) {
+	srv := forgeAPIServer(t)
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	defer func(c *http.Client, n int) { httpClient, maxRetries = c, n }(httpClient, maxRetries)
+	httpClient = &http.Client{Transport: hostHeader{toServer{u}}}
+	maxRetries = 0
+
+	tests := []struct {
+		repo    string
+		want    string
+		wantErr bool
+	}{
+		{"https://git.sr.ht/~user/repo", "develop", false},
+		{"https://git.sr.ht/~user/missing", "", true},
+		// A page that is not a ref advertisement
+		{"https://codeberg.org/api/v1/repos/user/empty", "", true},
+	}
+	for _, tt := range tests {
+		got, err := gitDefaultBranch(context.Background(), tt.repo)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("gitDefaultBranch(%s) = %q, %v, want %q, error %v", tt.repo, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func Test_findRemoteReadme_api(t *testing.T) {
+	srv := forgeAPIServer(t)
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	defer func(c *http.Client, f []forge, v *bool, n int) {
+		httpClient, forges, verbose, maxRetries = c, f, v, n
+	}(httpClient, forges, verbose, maxRetries)
+	// The server sees the original host in the Host header.
+	httpClient = &http.Client{Transport: hostHeader{toServer{u}}}
+	verbose, maxRetries = new(bool), 0
+	_ = registerForge("github", "ghe.example.com", "")
+	_ = registerForge("gitlab", "gl.example.com", "")
+	_ = registerForge("bitbucket-server", "bb.example.com", "")
+
+	tests := []struct {
+		name      string
+		locs      []location
+		ref       string
+		want      string
+		wantURL   string
+		wantExact bool
+	}{
+		{"github enterprise readme api",
+			[]location{{Root: "ghe.example.com/user/repo", Dir: "cmd/tool"}, {Root: "ghe.example.com/user/repo"}}, "v1.2.0",
+			"Tool\n====\n", "https://ghe.example.com/user/repo/raw/v1.2.0/docs/README.rst", true},
+		{"github download url without token",
+			[]location{{Root: "ghe.example.com/user/private"}}, "",
+			"# Private\n", "https://ghe.example.com/user/private/raw/main/README.md", false},
+		{"gitlab tree api",
+			[]location{{Root: "gl.example.com/group/sub/repo", Dir: "cmd/tool"}}, "",
+			"# Tool\n", "https://gl.example.com/api/v4/projects/group%2Fsub%2Frepo/repository/files/cmd%2Ftool%2FReadme.markdown/raw?ref=HEAD", false},
+		{"gitlab default branch",
+			[]location{{Root: "gl.example.com/other/repo"}}, "",
+			"# Other\n", "https://gl.example.com/other/repo/-/raw/develop/README.md", false},
+		{"branch ref is not exact",
+			[]location{{Root: "gl.example.com/other/repo"}}, "develop",
+			"# Other\n", "https://gl.example.com/other/repo/-/raw/develop/README.md", false},
+		{"codeberg contents api",
+			[]location{{Root: "codeberg.org/user/repo", Dir: "cmd/tool"}, {Root: "codeberg.org/user/repo"}}, "v0.4.1",
+			"# Codeberg tool\n", "https://codeberg.org/user/repo/raw/tag/v0.4.1/cmd/tool/README.md", true},
+		{"codeberg default branch",
+			[]location{{Root: "codeberg.org/user/empty"}}, "",
+			"Empty\n", "https://codeberg.org/user/empty/raw/branch/trunk/README", false},
+		{"sourcehut default branch",
+			[]location{{Root: "git.sr.ht/~user/repo", Dir: "cmd/tool"}}, "",
+			"# sr.ht tool\n", "https://git.sr.ht/~user/repo/blob/develop/cmd/tool/README.md", false},
+		{"sourcehut mercurial",
+			[]location{{Root: "hg.sr.ht/~user/repo"}}, "",
+			"# hg.sr.ht\n", "https://hg.sr.ht/~user/repo/raw/README.md?rev=default", false},
+		{"bitbucket cloud source api",
+			[]location{{Root: "bitbucket.org/vendor/tool", Dir: "cmd/tool"}}, "",
+			"Vendor\n", "https://api.bitbucket.org/2.0/repositories/vendor/tool/src/develop/cmd/tool/README", false},
+		{"bitbucket server browse api",
+			[]location{{Root: "bb.example.com/scm/tools/tool.git", Dir: "cmd/tool"}}, "v1.0.0",
+			"# Internal\n", "https://bb.example.com/projects/TOOLS/repos/tool/raw/cmd/tool/README.md?at=refs%2Ftags%2Fv1.0.0", true},
+		{"bitbucket server default branch",
+			[]location{{Root: "bb.example.com/scm/~jdoe/old.git"}}, "",
+			"# Old\n", "https://bb.example.com/users/jdoe/repos/old/raw/README.md?at=refs%2Fheads%2Ftrunk", false},
+		{"gitiles base64",
+			[]location{{Root: "go.googlesource.com/tools", Dir: "gopls"}, {Root: "go.googlesource.com/tools"}}, "gopls/v0.16.0",
+			"# gopls\n\n`gopls` is the Go language server.\n", "https://go.googlesource.com/tools/+/refs/tags/gopls/v0.16.0/gopls/README.md?format=TEXT", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, url, exact, err := findRemoteReadme(tt.locs, tt.ref)
+			if err != nil {
+				t.Fatalf("findRemoteReadme() error = %v", err)
+			}
+			if string(r.Content) != tt.want || url != tt.wantURL || exact != tt.wantExact {
+				t.Errorf("findRemoteReadme() = %q, %s, %v, want %q, %s, %v", r.Content, url, exact, tt.want, tt.wantURL, tt.wantExact)
+			}
+		})
+	}
+}
+
+// hostHeader keeps the original host of a request in the Host header,
+// so that a test server sees it after the request was redirected to it.
+type hostHeader struct {
+	base http.RoundTripper
+}
+
+func (h hostHeader) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Host = r.URL.Host
+	return h.base.RoundTrip(r)
+}
@@ -0,0 +1,241 @@
+// (C) 2017 Christoph Berger <mail@christophberger.com>. Some rights reserved.
+// Distributed under a 3-clause BSD license; see LICENSE.txt.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// vcsTimeout limits the time that a version control tool may take
+// to fetch a README file from a repository.
+var vcsTimeout = time.Minute
+
+// vcsSchemes are the URL schemes of the repositories that goman passes on to
+// the version control tools, the same that the go command accepts.
+var vcsSchemes = map[string][]string{
+	"git":    {"https", "http", "git", "git+ssh", "ssh"},
+	"hg":     {"https", "http", "ssh"},
+	"fossil": {"https", "http"},
+	"bzr":    {"https", "http", "bzr", "bzr+ssh"},
+	"svn":    {"https", "http", "svn", "svn+ssh"},
+}
+
+// gitAllowProtocol is the list of transports that git may use (see
+// GIT_ALLOW_PROTOCOL in the git documentation). It rules out local files,
+// also after a redirect or a URL rewrite, unless the repository URL is
+// a file:// URL from the configuration file.
+var gitAllowProtocol = "https:http:git:ssh"
+
+// findGitReadme is a helper function for findReadme. If no raw file URL
+// delivers the README, findGitReadme fetches it from the repository itself
+// with the local git binary, which works for any Git host. file:// remotes
+// work only for module path overrides from the configuration file; the URL
+// from a go-import meta tag must pass checkRepoURL.
+//
+// To keep the download small, findGitReadme does not clone the repository.
+// It fetches only the commit at ref (or at HEAD, if ref is empty or cannot
+// be fetched) with a shallow, blobless fetch, which transfers the trees but
+// no file contents. git then downloads the one README blob on demand.
+// The README is searched in the directories of locs that belong to repo.
+func findGitReadme(repo repository, locs []location, ref string) (readme []byte, source string, exact bool, err error) {
+	if err := checkRepoURL("git", repo.cloneURL(), repo.Configured); err != nil {
+		return nil, "", false, err
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, "", false, errors.New("git is not installed, cannot fetch the README from the repository " + repo.cloneURL())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), vcsTimeout)
+	defer cancel()
+
+	dir, err := os.MkdirTemp("", "goman-git-")
+	if err != nil {
+		return nil, "", false, errors.Wrap(err, "cannot create a temporary git repository")
+	}
+	defer os.RemoveAll(dir)
+
+	g := gitRepo{ctx: ctx, dir: dir, protocols: gitAllowProtocol}
+	if repo.Configured {
+		g.protocols += ":file"
+	}
+	if _, err := g.run("init", "-q"); err != nil {
+		return nil, "", false, err
+	}
+	if _, err := g.run("remote", "add", "--", "origin", repo.cloneURL()); err != nil {
+		return nil, "", false, err
+	}
+
+	refs := candidateRefs(ref, "HEAD")
+	if isCommitID(ref) && len(ref) < 40 {
+		// git fetches commits by their full ID only, and the abbreviated
+		// one of a pseudo-version cannot be resolved without a clone.
+		if *verbose {
+			log.Println("cannot fetch the abbreviated commit " + ref + " with git, using the default branch")
+		}
+		refs = candidateRefs("", "HEAD")
+	}
+	for _, r := range refs {
+		if _, err = g.run("fetch", "-q", "--depth=1", "--filter=blob:none", "--no-tags", "--", "origin", r); err != nil {
+			if *verbose {
+				log.Println(err)
+			}
+			continue
+		}
+		for _, d := range repoDirs(repo, locs) {
+			readme, file, e := g.readme(d)
+			if e != nil {
+				err = e
+				continue
+			}
+			return readme, "git " + repo.cloneURL() + " " + r + ":" + file, r == ref && isImmutableRef(ref), nil
+		}
+	}
+	return nil, "", false, errors.Wrap(err, "no README in the git repository "+repo.cloneURL())
+}
+
+// checkRepoURL checks the URL of a repository from a go-import meta tag before
+// it goes to the tool of the version control system vcs, like the go command
+// does: the URL must have one of the vcsSchemes of the tool, and a host.
+// Anything else, like a local path, or an argument, user, or host that starts
+// with a dash, could make the tool (or ssh) read local files or take the URL
+// for an option. If configured is true, the URL comes from the configuration
+// file, and a file:// URL is fine, too.
+func checkRepoURL(vcs, rawURL string, configured bool) error {
+	if strings.HasPrefix(rawURL, "-") {
+		return errors.Errorf("invalid repository URL %q", rawURL)
+	}
+	u, err := url.Parse(rawURL)
+	switch {
+	case err != nil:
+		return errors.Wrapf(err, "invalid repository URL %q", rawURL)
+	case configured && u.Scheme == "file" && u.Path != "":
+		return nil
+	case !slices.Contains(vcsSchemes[vcs], u.Scheme):
+		return errors.Errorf("invalid repository URL %q: scheme %q is not allowed for %s", rawURL, u.Scheme, vcs)
+	case u.Host == "":
+		return errors.Errorf("invalid repository URL %q: no host", rawURL)
+	case strings.HasPrefix(u.Host, "-") || strings.HasPrefix(u.Hostname(), "-") || strings.HasPrefix(u.User.Username(), "-"):
+		return errors.Errorf("invalid repository URL %q: the host or user looks like an option", rawURL)
+	}
+	return nil
+}
+
+// repoDirs returns the directories of locs within repo, in the order of locs.
+func repoDirs(repo repository, locs []location) []string {
+	var dirs []string
+	seen := map[string]bool{}
+	for _, loc := range locs {
+		if loc.Root == repo.Root && !seen[loc.Dir] {
+			seen[loc.Dir] = true
+			dirs = append(dirs, loc.Dir)
+		}
+	}
+	if len(dirs) == 0 {
+		dirs = []string{repo.Subdir}
+	}
+	return dirs
+}
+
+// gitRepo is a temporary local repository for fetching files from a remote.
+type gitRepo struct {
+	ctx       context.Context
+	dir       string
+	protocols string // for GIT_ALLOW_PROTOCOL
+}
+
+// run runs git with args in the repository.
+func (g gitRepo) run(args ...string) ([]byte, error) {
+	cmd := g.command(args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "git %s failed: %s", strings.Join(args, " "), strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// command returns the command for running git with args in the repository.
+// git must never ask for credentials, as there may be no one to answer,
+// and it may use the transports of g.protocols only.
+func (g gitRepo) command(args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(g.ctx, "git", args...)
+	cmd.Dir = g.dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GCM_INTERACTIVE=never", "GIT_ALLOW_PROTOCOL="+g.protocols)
+	if os.Getenv("GIT_SSH_COMMAND") == "" {
+		cmd.Env = append(cmd.Env, "GIT_SSH_COMMAND=ssh -o BatchMode=yes")
+	}
+	return cmd
+}
+
+// readme returns the README in directory dir of the fetched commit,
+// and its path.
+func (g gitRepo) readme(dir string) ([]byte, string, error) {
+	args := []string{"ls-tree", "FETCH_HEAD"}
+	if dir != "" {
+		args = append(args, dir+"/")
+	}
+	out, err := g.run(args...)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Each line is "<mode> <type> <object>\t<path>".
+	var files []string
+	for _, line := range strings.Split(string(out), "\n") {
+		info, p, ok := strings.Cut(line, "\t")
+		if ok && strings.Contains(info, " blob ") {
+			files = append(files, path.Base(p))
+		}
+	}
+	name := pickReadme(files)
+	if name == "" {
+		return nil, "", errNotFound{"no README in directory /" + dir}
+	}
+
+	file := path.Join(dir, name)
+	readme, err := commandReadme(g.command("cat-file", "blob", "FETCH_HEAD:"+file))
+	return readme, file, err
+}
+
+// commandReadme runs cmd and reads the README from its output like
+// readReadme does, so that no more than maxReadmeSize bytes end up
+// in memory.
+func commandReadme(cmd *exec.Cmd) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot run "+cmd.Path)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, errors.Wrap(err, "cannot run "+cmd.Path)
+	}
+	readme, truncated, err := readLimited(stdout)
+	if truncated {
+		// The rest of the output is not needed.
+		_ = cmd.Process.Kill()
+	}
+	if werr := cmd.Wait(); werr != nil && !truncated {
+		return nil, errors.Wrapf(werr, "%s failed: %s", strings.Join(cmd.Args, " "), strings.TrimSpace(stderr.String()))
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read the output of "+strings.Join(cmd.Args, " "))
+	}
+	if truncated {
+		readme = appendTruncationNotice(readme)
+	}
+	return readme, nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// gitTestRepo creates a Git repository with the given files, commits them,
+// and tags the commit with tag. Then it removes the cmd directory in a second
+// commit. For the rest of the test, git fetches from the repository instead
+// of from the URL remote. gitTestRepo returns the file:// URL of the
+// repository and the ID of the tagged commit.
+func gitTestRepo(t *testing.T, remote string, files map[string]string, tag string) (fileURL, commit string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	for name, content := range files {
+		fp := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fp), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fp, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git := func(args ...string) {
+		args = append([]string{"-c", "user.name=goman", "-c", "user.email=goman@example.com", "-c", "commit.gpgsign=false", "-c", "tag.gpgsign=false"}, args...)
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	git("init", "-q", "-b", "main")
+	git("add", "-A")
+	git("commit", "-q", "-m", "initial commit")
+	git("tag", tag)
+	git("rm", "-q", "-r", "cmd")
+	git("commit", "-q", "-m", "remove cmd")
+
+	out, err := exec.Command("git", "-C", dir, "rev-parse", tag).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileURL = "file://" + filepath.ToSlash(dir)
+	t.Setenv("GIT_CONFIG_COUNT", "1")
+	t.Setenv("GIT_CONFIG_KEY_0", "url."+fileURL+".insteadOf")
+	t.Setenv("GIT_CONFIG_VALUE_0", remote)
+	protocols := gitAllowProtocol
+	gitAllowProtocol += ":file"
+	t.Cleanup(func() { gitAllowProtocol = protocols })
+	return fileURL, strings.TrimSpace(string(out))
+}
+
+func Test_findGitReadme(t *testing.T) {
+	url := "https://git.example.com/tool"
+	_, commit := gitTestRepo(t, url, map[string]string{
+		"README.md":          "# Root\n",
+		"cmd/tool/README":    "Tool\n",
+		"cmd/tool/main.go":   "package main\n",
+		"cmd/other/main.go":  "package main\n",
+		"internal/README.md": "# Internal\n",
+	}, "v1.0.0")
+
+	defer func(v *bool) { verbose = v }(verbose)
+	verbose = new(bool)
+
+	repo := repository{Root: "example.com/tool", URL: url}
+	tests := []struct {
+		name       string
+		dirs       []string
+		ref        string
+		want       string
+		wantSource string
+		wantExact  bool
+		wantErr    bool
+	}{
+		{"tag", []string{"cmd/tool", ""}, "v1.0.0", "Tool\n", "git " + url + " v1.0.0:cmd/tool/README", true, false},
+		{"tag, up the tree", []string{"cmd/other", "cmd", ""}, "v1.0.0", "# Root\n", "git " + url + " v1.0.0:README.md", true, false},
+		{"default branch", []string{"cmd/tool", ""}, "", "# Root\n", "git " + url + " HEAD:README.md", false, false},
+		{"unknown ref", []string{"cmd/tool", ""}, "v2.0.0", "# Root\n", "git " + url + " HEAD:README.md", false, false},
+		{"commit", []string{"cmd/tool", ""}, commit, "Tool\n", "git " + url + " " + commit + ":cmd/tool/README", true, false},
+		{"abbreviated commit", []string{"cmd/tool", ""}, commit[:12], "# Root\n", "git " + url + " HEAD:README.md", false, false},
+		{"no readme", []string{"cmd/other"}, "v1.0.0", "", "", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var locs []location
+			for _, d := range tt.dirs {
+				locs = append(locs, location{Root: repo.Root, Dir: d})
+			}
+			got, source, exact, err := findGitReadme(repo, locs, tt.ref)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("findGitReadme() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if string(got) != tt.want || source != tt.wantSource || exact != tt.wantExact {
+				t.Errorf("findGitReadme() = %q, %q, %v, want %q, %q, %v", got, source, exact, tt.want, tt.wantSource, tt.wantExact)
+			}
+		})
+	}
+}
+
+func Test_findGitReadme_localRepository(t *testing.T) {
+	url := "https://git.example.com/tool"
+	fileURL, _ := gitTestRepo(t, url, map[string]string{"README.md": "# Root\n", "cmd/main.go": "package main\n"}, "v1.0.0")
+	gitAllowProtocol = "https:http:git:ssh"
+
+	defer func(v *bool) { verbose = v }(verbose)
+	verbose = new(bool)
+
+	// Only the configuration file may point git to the local file system.
+	tests := []struct {
+		name    string
+		repo    repository
+		wantErr bool
+	}{
+		{"rewritten to a local repository", repository{Root: "git.example.com/tool", URL: url}, true},
+		{"file url from go-import", repository{Root: "git.example.com/tool", URL: fileURL}, true},
+		{"file url from the configuration", repository{Root: "git.example.com/tool", URL: fileURL, Configured: true}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, _, err := findGitReadme(tt.repo, nil, "v1.0.0")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("findGitReadme() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && string(got) != "# Root\n" {
+				t.Errorf("findGitReadme() = %q, want the README", got)
+			}
+		})
+	}
+}
+
+func Test_checkRepoURL(t *testing.T) {
+	tests := []struct {
+		vcs        string
+		url        string
+		configured bool
+		wantErr    bool
+	}{
+		{"git", "https://github.com/user/repo", false, false},
+		{"git", "ssh://git@example.com/repo.git", false, false},
+		{"git", "git://example.com/repo", false, false},
+		{"git", "file:///tmp/repo", false, true},
+		{"git", "file:///tmp/repo", true, false},
+		{"git", "/tmp/repo", false, true},
+		{"git", "/tmp/repo", true, true},
+		{"git", "ext::sh -c touch% /tmp/pwned", false, true},
+		{"git", "-uhttps://example.com/repo", false, true},
+		{"git", "https:///repo", false, true},
+		{"git", "https://example.com/%zz", false, true},
+		{"git", "ssh://-oProxyCommand=id/x", false, true},
+		{"git", "ssh://-oProxyCommand=id:22/x", false, true},
+		{"git", "ssh://-oProxyCommand=id@example.com/x", false, true},
+		{"hg", "ssh://-oProxyCommand=id/x", false, true},
+		{"bzr", "bzr+ssh://-oProxyCommand=id/x", false, true},
+		{"svn", "svn+ssh://-oProxyCommand=id/x", false, true},
+		{"svn", "svn+ssh://svn.example.com/repo", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.vcs+" "+tt.url, func(t *testing.T) {
+			if err := checkRepoURL(tt.vcs, tt.url, tt.configured); (err != nil) != tt.wantErr {
+				t.Errorf("checkRepoURL(%q, %q, %v) error = %v, wantErr %v", tt.vcs, tt.url, tt.configured, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_commandReadme(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not installed")
+	}
+	defer func(m int64) { maxReadmeSize = m }(maxReadmeSize)
+	maxReadmeSize = 16
+
+	tests := []struct {
+		name    string
+		script  string
+		want    string
+		wantErr bool
+	}{
+		{"short", "printf 'line 1\\nline 2\\n'", "line 1\nline 2\n", false},
+		{"endless", "while :; do echo line; done", string(appendTruncationNotice([]byte("line\nline\nline\n"))), false},
+		{"failure", "echo oops >&2; exit 1", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := commandReadme(exec.Command("sh", "-c", tt.script))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("commandReadme() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Errorf("commandReadme() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
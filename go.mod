@@ -3,12 +3,15 @@ module github.com/appliedgocode/goman
 go 1.26.4
 
 require (
+	github.com/BurntSushi/toml v1.6.0
 	github.com/ec1oud/blackfriday v0.0.0-20170301190602-4575f80c9153
 	github.com/pkg/errors v0.9.1
-	golang.org/x/term v0.44.0
+	golang.org/x/mod v0.41.0
+	golang.org/x/net v0.60.0
+	golang.org/x/term v0.46.0
 )
 
 require (
 	github.com/shurcooL/sanitized_anchor_name v1.0.0 // indirect
-	golang.org/x/sys v0.46.0 // indirect
+	golang.org/x/sys v0.48.0 // indirect
 )
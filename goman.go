@@ -4,8 +4,9 @@
 package main
 
 import (
-	"bufio"
+	"context"
 	"debug/buildinfo"
+	"encoding/json"
 	"fmt"
 	"go/build"
 	"io"
@@ -13,10 +14,13 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"runtime/debug"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ec1oud/blackfriday"
@@ -26,59 +30,171 @@ import (
 
 var (
 	names = []string{"README.md", "README", "README.txt", "readme.md", "readme", "readme.txt", "README.MD", "README.TXT"}
+
+	// branches are the usual names of default branches.
+	branches = []string{"main", "trunk", "master"}
+
+	httpClient = &http.Client{
+		Timeout:   time.Second * 10,
+		Transport: &authTransport{base: http.DefaultTransport},
+	}
 )
 
+// errOffline is returned for every HTTP request in offline mode.
+var errOffline = errors.New("offline mode")
+
+// offlineSkipped lists the sources that findReadme does not search in offline mode.
+const offlineSkipped = "the module proxy and the remote repository"
+
+// offlineTransport refuses all requests, to make sure that goman does not
+// touch the network in offline mode.
+type offlineTransport struct{}
+
+func (offlineTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	return nil, errors.Wrap(errOffline, "refusing to request "+r.URL.String())
+}
+
+// searchLocal reports whether findReadme searches the local sources.
+// In offline mode, these are the only sources, so -r does not apply.
+func searchLocal() bool {
+	return !*remoteOnly || *offline
+}
+
 func run(exec string) {
 
-	// Determine the location of `exec`
-	path, err := getExecPath(exec)
-	if err != nil {
-		log.Println(exec + ": command not found")
+	bi, ok := resolveArg(exec)
+	if !ok {
+		return
+	}
+
+	// Find the README
+	readme, source, err := findReadme(bi)
+	var rl *rateLimitError
+	if errors.As(err, &rl) {
+		log.Println("Cannot fetch the README for", exec, "from", bi.Path+":", rl.hint())
 		if *verbose {
 			log.Println(errors.WithStack(err))
 		}
 		return
 	}
-
-	// Extract the source path from the binary
-	src, ver, err := getMainPathAndVersion(path)
 	if err != nil {
-		log.Println("No source path in", path, "-", exec, "is perhaps no Go binary")
+		log.Println("No README found for", exec, "in", bi.Path)
+		if *offline {
+			log.Println("Offline mode: skipped " + offlineSkipped)
+		}
 		if *verbose {
 			log.Println(errors.WithStack(err))
 		}
 		return
 	}
 
-	// Find the README
-	readme, source, err := findReadme(src, ver)
+	readme = mdToAnsi(readme)
+
+	fmt.Printf("%s\n\n(Source: %s)\n\n", string(readme), sanitize([]byte(source)))
+
+	if bi.Modified {
+		fmt.Printf("(Note: %s was built from a modified working tree at revision %s. The README may not match the binary.)\n\n", exec, bi.Revision)
+	}
+}
+
+// resolveArg determines the source of the binary named exec, or, if exec is
+// a package path with an optional version query (path@version) and no binary
+// of this name exists, the source of the package. resolveArg logs the reason
+// if it finds neither.
+func resolveArg(exec string) (binInfo, bool) {
+	// Determine the location of `exec`
+	path, err := getExecPath(exec)
 	if err != nil {
-		log.Println("No README found for", exec, "in", src)
+		pkg, query, ok := strings.Cut(exec, "@")
+		if ok || isImportPath(exec) {
+			bi, err := resolveQuery(pkg, query)
+			if err != nil {
+				log.Println(err)
+				return binInfo{}, false
+			}
+			return bi, true
+		}
+		log.Println(exec + ": command not found")
 		if *verbose {
 			log.Println(errors.WithStack(err))
 		}
-		return
+		return binInfo{}, false
 	}
 
-	readme = mdToAnsi(readme)
-
-	fmt.Printf("%s\n\n(Source: %s)\n\n", string(readme), source)
+	// Extract the source path from the binary
+	bi, err := getBinInfo(path)
+	if err != nil {
+		log.Println("No source path in", path, "-", exec, "is perhaps no Go binary")
+		if *verbose {
+			log.Println(errors.WithStack(err))
+		}
+		return binInfo{}, false
+	}
+	return bi, true
+}
 
+// binInfo describes where the source code of a binary comes from.
+type binInfo struct {
+	Path    string // import path of the main package
+	Module  string // path of the main module; empty for pre-module binaries
+	Version string // version of the main module; empty if unknown
+
+	// Version control information, recorded when the binary
+	// was built inside a repository checkout
+	VCS      string // version control system, e.g. "git"
+	Revision string // commit ID the binary was built from
+	Time     string // commit time in RFC3339 format
+	Modified bool   // the working tree had uncommitted changes
 }
 
-// getMainPathAndVersion fetches the main maodule path from the binary>'s
+// getBinInfo fetches the main package path and the main module from the binary's
 // build info, or, if the binary is from the pre-module era,
-// from the respective info in the symbol table.
-func getMainPathAndVersion(file string) (string, string, error) {
+// the main package path from the respective info in the symbol table.
+func getBinInfo(file string) (binInfo, error) {
 	bi, err := buildinfo.ReadFile(file)
 	if err != nil {
-		return getMainPathDwarf(file)
+		path, version, err := getMainPathDwarf(file)
+		return binInfo{Path: path, Version: version}, err
+	}
+	return binInfoFrom(bi), nil
+}
+
+// binInfoFrom extracts the relevant parts of the build info.
+func binInfoFrom(bi *debug.BuildInfo) binInfo {
+	info := binInfo{Path: bi.Path, Module: bi.Main.Path, Version: bi.Main.Version}
+	if info.Version == "(devel)" {
+		info.Version = ""
 	}
-	version := bi.Main.Version
-	if version == "(devel)" {
-		version = ""
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs":
+			info.VCS = s.Value
+		case "vcs.revision":
+			info.Revision = s.Value
+		case "vcs.time":
+			info.Time = s.Value
+		case "vcs.modified":
+			info.Modified = s.Value == "true"
+		}
+	}
+	return info
+}
+
+// ref returns the revision to fetch the README from the repository at.
+// For module versions, this is the tag or commit that the version refers to.
+// subdir is the module's directory within the repository, which prefixes the tag.
+// Development builds, which have no module version, use the VCS revision.
+func (bi binInfo) ref(subdir string) string {
+	if bi.Version != "" {
+		ref := gitRef(bi.Version, subdir)
+		// The full commit ID from the VCS build settings beats the
+		// abbreviated one of a pseudo-version.
+		if isCommitID(ref) && strings.HasPrefix(bi.Revision, ref) {
+			return bi.Revision
+		}
+		return ref
 	}
-	return bi.Path, version, nil
+	return bi.Revision
 }
 
 // getExecPath receives the name of an executable and determines its path
@@ -128,101 +244,181 @@ func pathssep() string {
 // variable, or the default gopath if $GOPATH is empty.
 func gopath() []string {
 
-	gp := os.Getenv("GOPATH")
+	gp := goEnv("GOPATH")
 	if gp == "" {
-		cmd := exec.Command("go", "env", "GOPATH")
-		gpb, err := cmd.CombinedOutput()
-		if err != nil {
-			return []string{build.Default.GOPATH}
-		}
-		// CombinedOutput seems to include the newline char - remove it
-		gp = strings.TrimRight(string(gpb), "\n")
+		return []string{build.Default.GOPATH}
 	}
 
 	return strings.Split(gp, pathssep())
 }
 
-// findReadme attempts to find the file README.md either locally
+// goEnvKeys are the variables that goEnv can look up with `go env`.
+var goEnvKeys = []string{"GOPATH", "GOPROXY", "GOPRIVATE", "GONOPROXY", "GONOSUMDB", "GOMODCACHE"}
+
+var (
+	goEnvOnce   sync.Once
+	goEnvValues map[string]string
+)
+
+// goEnv returns the value of the environment variable `key`. If the variable
+// is not set, goEnv asks `go env` (which also knows about the settings made
+// with `go env -w`), and returns an empty string if this fails as well.
+// goEnv runs `go env` only once, for all of goEnvKeys.
+func goEnv(key string) string {
+
+	if val := os.Getenv(key); val != "" {
+		return val
+	}
+
+	goEnvOnce.Do(func() {
+		cmd := exec.Command("go", append([]string{"env", "-json"}, goEnvKeys...)...)
+		// `go env` derives GONOPROXY and GONOSUMDB from GOPRIVATE. The
+		// callers of goEnv do this themselves, from the current environment.
+		cmd.Env = append(os.Environ(), "GOPRIVATE=", "GONOPROXY=", "GONOSUMDB=")
+		out, err := cmd.Output()
+		if err == nil {
+			_ = json.Unmarshal(out, &goEnvValues)
+		}
+	})
+	return goEnvValues[key]
+}
+
+// findReadme attempts to find the file README.md either locally,
+// in the README cache,
+// in the module zip file at the module proxy,
 // or in the remote repository of the executable.
-func findReadme(src, ver string) (readme []byte, source string, err error) {
+// In offline mode, findReadme searches the local sources and the README cache only,
+// and accepts expired cache entries.
+func findReadme(bi binInfo) (readme []byte, source string, err error) {
 
-	src = stripModVersion(src)
-	srcs := sources(src)
+	src := stripModVersion(bi.Path)
+	ver := bi.Version
 
-	if !*remoteOnly {
-		readme, source, err = findLocalReadme(srcs)
+	if searchLocal() {
+		readme, source, err = findLocalReadme(src, bi.Module, ver)
 		if err == nil {
 			return readme, source, nil
 		}
 	}
 
-	readme, source, err = findRemoteReadme(srcs, ver)
+	key := cacheKey(src, bi)
+	readme, source, err = findCachedReadme(key)
+	if err == nil {
+		return readme, source, nil
+	}
+	if err != errCacheMiss {
+		return fallbackReadme(src, bi, err)
+	}
+
+	if *offline {
+		if *verbose {
+			log.Println("Offline mode: skipping " + offlineSkipped)
+		}
+		if readme, source, err := staleReadme(key); err == nil {
+			return readme, source, nil
+		}
+		return fallbackReadme(src, bi, errors.Wrap(errOffline, "skipped "+offlineSkipped))
+	}
+
+	// The module zip file contains the README at exactly the installed version.
+	var proxyErr error
+	if bi.Module != "" && ver != "" {
+		readme, source, proxyErr = findProxyReadme(src, bi.Module, ver)
+		if proxyErr == nil {
+			cacheReadme(cacheEntry{Key: key, Source: source, Content: readme}, true)
+			return readme, source, nil
+		}
+		if *verbose {
+			log.Println(proxyErr)
+		}
+	}
+
+	repo, locs := remoteLocations(src, bi.Module)
+	ref := bi.ref(repo.Subdir)
+	r, url, exact, err := findRemoteReadme(locs, ref)
 	if err != nil {
-		return nil, "", errors.Wrap(err, "Did not find a readme locally nor in the remote repository")
+		// The repository itself is the last resort.
+		readme, source, exact, e := findRepoReadme(repo, locs, ref)
+		if e == nil {
+			cacheReadme(cacheEntry{Key: key, Source: source, Content: readme}, exact)
+			return readme, source, nil
+		}
+		if *verbose {
+			log.Println(e)
+		}
+
+		// An outdated README from the cache is better than none.
+		if readme, source, e := staleReadme(key); e == nil {
+			return readme, source, nil
+		}
+		// Remember the miss only if every source answered that there is no
+		// README. A network failure or a rate limit says nothing about its
+		// existence.
+		if (proxyErr == nil || isNotFound(proxyErr) || errors.Is(proxyErr, errProxyDirect)) && isNotFound(err) && isNotFound(e) {
+			cacheMiss(key)
+		}
+		return fallbackReadme(src, bi, err)
 	}
 
-	return readme, source, nil
+	cacheReadme(cacheEntry{Key: key, Source: url, Content: r.Content, ETag: r.ETag, LastModified: r.LastModified}, exact)
+	return r.Content, url, nil
+}
+
+// fallbackReadme is a helper function for findReadme. If no README was found for
+// the installed version, a README from another version is better than none.
+func fallbackReadme(src string, bi binInfo, err error) ([]byte, string, error) {
+	if searchLocal() && bi.Module != "" {
+		readme, source, e := findNewestCachedReadme(src, bi.Module, bi.Version)
+		if e == nil {
+			return readme, source, nil
+		}
+	}
+	return nil, "", errors.Wrap(err, "Did not find a readme locally nor in the remote repository")
 }
 
 // findLocalReadme is a helper function for findReadme. It searches the README file
-// locally in $GOPATH/src/<src> or $GOPATH/pkg/mod/<src>.
+// locally, first in the module cache at the installed version, then in $GOPATH/src/<src>.
 // If the path is absolute, this means it neither contains /src/ nor /pkg/mod/.
 // In this case, findLocalReadme uses the full path.
-func findLocalReadme(sources []string) (readme []byte, fp string, err error) {
+func findLocalReadme(pkg, mod, ver string) (readme []byte, fp string, err error) {
 
-	found := false
-	var e error
+	if mod != "" && ver != "" {
+		readme, fp, err = findModCacheReadme(pkg, mod, ver)
+		if err == nil {
+			return readme, fp, nil
+		}
+	}
 
-allLoops:
-	// We have to search across all gopath elements, across all README file names,
-	// and also up the directory tree (in case the command is a subproject)
-	for _, gp := range gopath() {
-		for _, name := range names {
-			for _, source := range sources {
-
-				var rf *os.File
-				found := false
-
-				// Create the path to the README file and open the file.
-				// If this fails, try the next GOPATH entry.
-				for _, prefix := range []string{"src", filepath.Join("pkg", "mod")} {
-					fp = filepath.Join(gp, prefix, source, name)
-					rf, err := os.Open(fp)
-					if err == nil {
-						found = true
-						break
-					}
-					e = errors.Wrap(err, "README not found at location "+fp)
-					_ = rf.Close()
-				}
+	if filepath.IsAbs(filepath.FromSlash(pkg)) {
+		return readmeFromDir(filepath.FromSlash(pkg), "")
+	}
 
-				if !found {
-					continue
-				}
+	locs := heuristicLocations(pkg)
+	if mod != "" {
+		locs = moduleRepository(mod).locations(pkgDir(pkg, mod))
+	}
+	return findGopathReadme(importPaths(locs))
+}
 
-				// Allocate the slice for reading the file.
-				fi, err := rf.Stat()
-				if err != nil {
-					return nil, "", errors.Wrapf(err, "Cannot determine file stats for %s", fp)
-				}
-				readme = make([]byte, fi.Size())
+// findGopathReadme searches the README file in $GOPATH/src/<source>,
+// across all GOPATH elements.
+func findGopathReadme(sources []string) (readme []byte, fp string, err error) {
 
-				// Read the whole file.
-				n, err := rf.Read(readme)
-				if err != nil {
-					return readme[:n], "", errors.Wrap(err, "error reading from file "+fp)
+	// We have to search across all gopath elements, across all README file names,
+	// and also up the directory tree (in case the command is a subproject)
+	for _, gp := range gopath() {
+		for _, source := range sources {
+			for _, name := range names {
+				fp = filepath.Join(gp, "src", filepath.FromSlash(source), name)
+				readme, err = readFileReadme(fp)
+				if err == nil {
+					return readme, fp, nil
 				}
-				_ = rf.Close()
-				break allLoops
 			}
 		}
 	}
 
-	if !found {
-		return nil, "", errors.Wrapf(e, "no README found for in any of %v\n", sources)
-	}
-
-	return readme, fp, err
+	return nil, "", errors.Errorf("no README found in any of %v in GOPATH", sources)
 }
 
 // stripModVersion strips a version suffix from a path.
@@ -240,57 +436,212 @@ func stripModVersion(path string) string {
 // findRemoteReadme is a helper function for findReadme. It attempts to locate the README in the remote repository at either of: -
 // - http(s)://host.com/<user>/<project>/blob/main/<readme name>
 // - http(s)://host.com/<user>/<project>/blob/main/cmd/<cmdname>/<readme name>
-func findRemoteReadme(sources []string, ver string) (readme []byte, url string, err error) {
-
-	var e error
-	// TODO: implement resolveVanityImport
-	// src, err = resolveVanityImports(src)
-	// if err != nil {
-	// 	return nil, "", errors.Wrap(err, "error resolving vanity import for "+src)
-	// }
+//
+// Forges with an API are asked for the README first (see findAPIReadme). If this
+// fails, findRemoteReadme guesses the URL. All candidate URLs are requested
+// concurrently. The candidates are ordered by remoteLocations() and
+// possibleReadmeURLs() from the most to the least likely location, and
+// findRemoteReadme returns the first one in this order that exists.
+// exact reports whether the README is the one at ref, and ref is a commit or
+// a tag, rather than the one at a branch, which may change.
+func findRemoteReadme(locs []location, ref string) (readme httpReadme, url string, exact bool, err error) {
+
+	readme, url, err = findAPIReadme(locs, ref)
+	if err == nil {
+		return readme, url, isImmutableRef(ref), nil
+	}
+	if *verbose {
+		log.Println(err)
+	}
 
-	for _, source := range sources {
-		urls := possibleReadmeURLs(source, ver)
+	// The default branches come from the same APIs, which are
+	// no use if they have rate-limited goman.
+	var defaults map[string]string
+	var rl *rateLimitError
+	if !errors.As(err, &rl) {
+		defaults = defaultBranches(locs)
+	}
+	var candidates []string
+	atRef := map[int]bool{} // candidates that are at exactly ref, which is a commit or tag
+	for _, loc := range locs {
+		refs := candidateRefs(ref, defaults[loc.Root])
 		for _, name := range names {
-			for _, url := range urls {
-				// TODO run all HTTP calls concurrently
-				readme, e = httpGetReadme(url + name)
-				if e == nil {
-					return readme, url, nil
+			if isImmutableRef(ref) && refs[0] == ref && forgeFor(loc.Root) != nil {
+				atRef[len(candidates)] = true
+			}
+			candidates = append(candidates, possibleReadmeURLs(loc, refs, name)...)
+		}
+	}
+	// The README pages of repository browsers are the last resort.
+	about := map[string]bool{}
+	for _, loc := range locs {
+		if p, ok := forgeFor(loc.Root).(aboutPager); ok && !about[loc.Root] {
+			about[loc.Root] = true
+			candidates = append(candidates, p.aboutURL(loc.Root))
+		}
+	}
+
+	results := make([]httpReadme, len(candidates))
+	errs := make([]error, len(candidates))
+	var limits hostLimits
+	i, _, err := firstSuccess(context.Background(), len(candidates), maxParallelRequests,
+		func(ctx context.Context, i int) ([]byte, error) {
+			errs[i] = limits.do(ctx, urlHost(candidates[i]), func(ctx context.Context) error {
+				var err error
+				results[i], err = httpGetReadme(ctx, candidates[i], nil)
+				return err
+			})
+			return results[i].Content, errs[i]
+		})
+	if err != nil {
+		// A rate limit, or any other failure, explains the outcome better
+		// than the "not found" of the first candidate.
+		if rl := limits.err(); rl != nil {
+			err = rl
+		} else {
+			for _, e := range errs {
+				if e != nil && !isNotFound(e) {
+					err = e
+					break
 				}
-				err = errors.Wrap(e, "") // collect all errors from the loop
 			}
 		}
+		return httpReadme{}, "", false, errors.Wrap(err, "failed to retrieve README")
 	}
 
-	return nil, "", errors.Wrap(e, "failed to retrieve README")
+	return results[i], candidates[i], atRef[i], nil
 }
 
-func httpGetReadme(url string) ([]byte, error) {
-	var client = &http.Client{
-		Timeout: time.Second * 10,
+// remoteLocations returns the repository of module mod and the candidate
+// locations of the README for package pkg, for use by findRemoteReadme.
+// If pkg is not located at a forge with a fixed path depth (see fixedDepthForge),
+// it may be a vanity import path like golang.org/x/tools, or a path on a forge
+// with nested groups, like GitLab. In this case, remoteLocations resolves the
+// go-import meta tag and puts the locations within the actual repository first.
+// Module path overrides from the configuration file work like go-import meta tags.
+// Binaries without module information get the locations from heuristicLocations,
+// unless the go-import meta tag tells where the repository root is.
+func remoteLocations(pkg, mod string) (repository, []location) {
+	repo := moduleRepository(mod)
+	locs := heuristicLocations(pkg)
+	if mod != "" {
+		locs = repo.locations(pkgDir(pkg, mod))
 	}
 
-	response, err := client.Get(url)
+	// Module path overrides from the configuration file come first.
+	mi := matchMetaImport(overrides, pkg)
+	if mi == nil {
+		if _, ok := forgeFor(pkg).(fixedDepthForge); ok {
+			return repo, locs
+		}
+
+		var err error
+		mi, err = resolveVanityImport(pkg)
+		if err != nil {
+			if *verbose {
+				log.Println(errors.Wrap(err, "error resolving vanity import for "+pkg))
+			}
+			return repo, locs
+		}
+	}
+
+	if mod != mi.Prefix && !strings.HasPrefix(mod, mi.Prefix+"/") {
+		mod = mi.Prefix
+	}
+	vanityRepo := mi.repository(mod)
+	return vanityRepo, append(vanityRepo.locations(pkgDir(pkg, mod)), locs...)
+}
+
+// httpReadme is a README file downloaded via HTTP, along with
+// the validators for revalidating a cached copy.
+type httpReadme struct {
+	Content      []byte
+	ETag         string
+	LastModified string
+	// NotModified is true if the server responded "304 Not Modified"
+	// to a conditional request. Content is empty then.
+	NotModified bool
+}
+
+// httpGetReadme downloads the README file at url. header contains
+// additional request headers, like If-None-Match for conditional requests.
+// If the server responds with "404 Not Found" or "410 Gone", the error is errNotFound.
+// A README rendered as HTML page is converted back to Markdown.
+func httpGetReadme(ctx context.Context, url string, header http.Header) (httpReadme, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return httpReadme{}, errors.Wrap(err, "invalid URL "+url)
+	}
+	for k, v := range header {
+		request.Header[k] = v
+	}
+	request.Header.Set("Accept-Encoding", "gzip, deflate")
+
+	response, err := doWithRetry(httpClient, request)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed downloading the README from "+url)
+		return httpReadme{}, errors.Wrap(err, "failed downloading the README from "+url)
 	}
+	defer response.Body.Close()
 
-	if response.StatusCode != 200 {
-		return nil, errors.New("HTTP GET returned " + response.Status + " for URL " + url)
+	readme := httpReadme{
+		ETag:         response.Header.Get("ETag"),
+		LastModified: response.Header.Get("Last-Modified"),
+	}
+	switch response.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		readme.NotModified = true
+		return readme, nil
+	case http.StatusNotFound, http.StatusGone:
+		return httpReadme{}, errNotFound{"HTTP GET returned " + response.Status + " for URL " + url}
+	default:
+		return httpReadme{}, errors.New("HTTP GET returned " + response.Status + " for URL " + url)
+	}
+
+	// goman asks for compressed responses itself, so the http package
+	// leaves the decompression to goman. readLimited detects gzip data
+	// on its own; this also covers servers that send gzip data without
+	// saying so.
+	body := io.Reader(response.Body)
+	if strings.EqualFold(response.Header.Get("Content-Encoding"), "deflate") {
+		zr, err := deflateReader(response.Body)
+		if err != nil {
+			return httpReadme{}, errors.Wrap(err, "invalid deflate data from "+url)
+		}
+		defer zr.Close()
+		body = zr
+	}
+	if strings.EqualFold(response.Header.Get("X-FYI-Content-Encoding"), "base64") {
+		body, err = base64Reader(body)
+		if err != nil {
+			return httpReadme{}, errors.Wrap(err, "invalid base64 data from "+url)
+		}
+	}
+	content, truncated, err := readLimited(body)
+	if err != nil {
+		return httpReadme{}, errors.Wrap(err, "error reading README from HTTP response")
 	}
 
-	r := bufio.NewReader(response.Body)
-	readme, err := r.ReadBytes(0)
-	if err != nil && err != io.EOF {
-		return nil, errors.Wrap(err, "error reading README from HTTP response")
+	// Hosts without a raw file view, and login pages, deliver HTML.
+	if isHTML(response.Header.Get("Content-Type"), content) {
+		content, err = readmeFromHTML(content)
+		if err != nil {
+			return httpReadme{}, errors.Wrap(err, url)
+		}
+	}
+	if truncated {
+		content = appendTruncationNotice(content)
 	}
+	readme.Content = content
 
 	return readme, nil
 }
 
-// source returns a slice containing `src` and all paths
+// sources returns a slice containing `src` and all paths
 // when walking the directory tree up to the root path.
+// Only heuristicLocations uses sources, for binaries without module
+// information. For all others, the module path tells where the
+// repository root and the major version subdirectory are.
 //
 // Example 1:
 //
@@ -316,7 +667,6 @@ func sources(src string) (srcs []string) {
 		match := versionRe.FindStringSubmatch(src)
 		if match != nil {
 			// path with version info found. Remove version string.
-			// TODO: instead of this workaround, find the readme at the proper git branch
 			return true, match[1], match[2], match[3]
 		}
 		return false, "", "", ""
@@ -350,79 +700,60 @@ func sources(src string) (srcs []string) {
 	return srcs
 }
 
-// TODO:
-// Resolve any redirects to get the correct URL to the remote repository.
-// func resolveVanityImports(src string) (string, error) {
-// 	var client = &http.Client{
-// 		Timeout: time.Second * 10,
-// 	}
-
-// 	response, err := client.Get("https://" + src + "?go-get=1")
-// 	if err != nil {
-// 		return "", errors.Wrap(err, "failed retrieving header data of URL "+src)
-// 	}
-
-// 	// TODO:
-// 	// extract meta tag "go-import" from response body
-// 	// <meta name="go-import" content="import-prefix vcs repo-root">
-// 	// get the `repo-root` part
-// 	// strip the https:// prefix
-// }
-
-// possibleReadmeURLs receives the relative path to the project and returns
-// the URL to the raw README.md file (WITHOUT the file name itself, but
-// WITH a trailing slash).
-// Currently it knows how to do this for github.com and gitlab.com only.
-// For all other sites, it returns `https://<src>/`.
+// candidateRefs returns the refs to look for the README at: ref (a commit ID,
+// tag, or branch) if not empty, followed by the repository's default branch,
+// or, if the default branch is unknown, by the usual names of default branches.
+func candidateRefs(ref, defaultBranch string) []string {
+	refs := branches
+	if defaultBranch != "" {
+		refs = []string{defaultBranch}
+	}
+	if ref != "" && ref != defaultBranch {
+		refs = append([]string{ref}, refs...)
+	}
+	return refs
+}
+
+// possibleReadmeURLs receives a location in the project and the name of
+// a README file, and returns the URLs where the raw README file may be found.
+// For repositories on one of the known forges, these are the URLs of the raw
+// file at refs (see candidateRefs). The last URL is always
+// `https://<root>/<dir>/<name>`, which is all that can be done for other sites.
 //
-// Examples:
+// Examples (with name = README.md):
 //
 // From github.com/ec1oud/mdcat to:
-// https://github.com/ec1oud/mdcat/blob/<branch>/
+// https://raw.githubusercontent.com/ec1oud/mdcat/<branch>/README.md
 //
 // From gitlab.com/SporeDB/sporedb to:
-// https://gitlab.com/SporeDB/sporedb/-/blob/<branch>/
+// https://gitlab.com/SporeDB/sporedb/-/raw/<branch>/README.md
 //
 // From git.sr.ht/~ghost08/photon to:
-// https://git.sr.ht/~ghost08/photon/tree/<branch>/item/
-func possibleReadmeURLs(src, ver string) []string {
-
-	prefix := "https://"
-	gh := "github.com/"
-	gl := "gitlab.com/"
-	sh := "https://git.sr.ht/"
-	// TODO: add source hut - https://git.sr.ht/~<user>/<project>/tree/<branch>/item/README.md
-	branches := []string{"main", "trunk", "master"}
+// https://git.sr.ht/~ghost08/photon/blob/<branch>/README.md
+//
+// From hg.sr.ht/~user/repo to:
+// https://hg.sr.ht/~user/repo/raw/README.md?rev=<branch>
+func possibleReadmeURLs(loc location, refs []string, name string) []string {
 
 	urls := []string{}
+	file := path.Join(loc.Dir, name)
 
-	src = strings.Trim(filepath.ToSlash(src), "/")
-
-	for _, branch := range branches {
-
-		// Process github paths
-		if len(src) >= len(gh) && src[:len(gh)] == gh {
-			urls = append(urls, fmt.Sprintf("%sraw.githubusercontent.com/%s/%s/", prefix, src[len(gl):], branch))
-		}
-
-		// Process gitlab paths
-		if len(src) >= len(gl) && src[:len(gl)] == gl {
-			// TODO -> raw URL includes the commit hash
-			urls = append(urls, fmt.Sprintf("%s%s/-/raw/%s/", prefix, src, branch))
-		}
-
-		// Process sourcehut paths
-		if len(src) >= len(sh) && src[:len(sh)] == sh {
-			urls = append(urls, fmt.Sprintf("%s%s/blob/%s/", prefix, src, branch))
+	if f := forgeFor(loc.Root); f != nil {
+		for _, r := range refs {
+			urls = append(urls, f.rawURL(loc.Root, r, file))
 		}
 	}
 
-	urls = append(urls, fmt.Sprintf("%s%s/", prefix, src))
+	urls = append(urls, "https://"+path.Join(loc.String(), name))
 	return urls
 }
 
+// mdToAnsi renders Markdown as text with ANSI styling.
+// The README is untrusted input, so mdToAnsi sanitizes it first.
 func mdToAnsi(readme []byte) []byte {
 
+	readme = sanitize(readme)
+
 	// The code in this function was copied from github.com/ec1oud/mdcat. See LICENSE.mdcat.txt
 	extensions := 0
 	extensions |= blackfriday.EXTENSION_NO_INTRA_EMPHASIS
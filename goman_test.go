@@ -1,57 +1,112 @@
 package main
 
 import (
+	"net/http"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"reflect"
+	"runtime/debug"
 	"strings"
+	"syscall"
 	"testing"
+	"time"
+
+	"github.com/pkg/errors"
 )
 
 func Test_getReadmeURL(t *testing.T) {
 	tests := []struct {
 		name    string
-		src     string
+		loc     location
+		ref     string
 		want    []string
 		wantErr bool
 	}{
 		{"github",
-			"github.com/user/repo",
+			location{Root: "github.com/user/repo"},
+			"",
 			[]string{
-				"https://raw.githubusercontent.com/user/repo/main/",
-				"https://raw.githubusercontent.com/user/repo/trunk/",
-				"https://raw.githubusercontent.com/user/repo/master/",
-				"https://github.com/user/repo/",
+				"https://raw.githubusercontent.com/user/repo/main/README.md",
+				"https://raw.githubusercontent.com/user/repo/trunk/README.md",
+				"https://raw.githubusercontent.com/user/repo/master/README.md",
+				"https://github.com/user/repo/README.md",
 			},
 			false},
 		{"githubcmd1",
-			"github.com/user/repo/cmd/cmdname",
+			location{Root: "github.com/user/repo", Dir: "cmd/cmdname"},
+			"",
 			[]string{
-				"https://raw.githubusercontent.com/user/repo/cmd/cmdname/main/",
-				"https://raw.githubusercontent.com/user/repo/cmd/cmdname/trunk/",
-				"https://raw.githubusercontent.com/user/repo/cmd/cmdname/master/",
-				"https://github.com/user/repo/cmd/cmdname/",
+				"https://raw.githubusercontent.com/user/repo/main/cmd/cmdname/README.md",
+				"https://raw.githubusercontent.com/user/repo/trunk/cmd/cmdname/README.md",
+				"https://raw.githubusercontent.com/user/repo/master/cmd/cmdname/README.md",
+				"https://github.com/user/repo/cmd/cmdname/README.md",
 			},
 			false},
 		{"gitlab",
-			"gitlab.com/user/repo",
+			location{Root: "gitlab.com/user/repo"},
+			"",
+			[]string{
+				"https://gitlab.com/user/repo/-/raw/main/README.md",
+				"https://gitlab.com/user/repo/-/raw/trunk/README.md",
+				"https://gitlab.com/user/repo/-/raw/master/README.md",
+				"https://gitlab.com/user/repo/README.md",
+			},
+			false},
+		{"githubrevision",
+			location{Root: "github.com/user/repo"},
+			"0123456789abcdef0123456789abcdef01234567",
 			[]string{
-				"https://gitlab.com/user/repo/-/raw/main/",
-				"https://gitlab.com/user/repo/-/raw/trunk/",
-				"https://gitlab.com/user/repo/-/raw/master/",
-				"https://gitlab.com/user/repo/",
+				"https://raw.githubusercontent.com/user/repo/0123456789abcdef0123456789abcdef01234567/README.md",
+				"https://raw.githubusercontent.com/user/repo/main/README.md",
+				"https://raw.githubusercontent.com/user/repo/trunk/README.md",
+				"https://raw.githubusercontent.com/user/repo/master/README.md",
+				"https://github.com/user/repo/README.md",
+			},
+			false},
+		{"gitlabrevision",
+			location{Root: "gitlab.com/user/repo"},
+			"0123456789abcdef0123456789abcdef01234567",
+			[]string{
+				"https://gitlab.com/user/repo/-/raw/0123456789abcdef0123456789abcdef01234567/README.md",
+				"https://gitlab.com/user/repo/-/raw/main/README.md",
+				"https://gitlab.com/user/repo/-/raw/trunk/README.md",
+				"https://gitlab.com/user/repo/-/raw/master/README.md",
+				"https://gitlab.com/user/repo/README.md",
+			},
+			false},
+		{"gitlabnested",
+			location{Root: "gitlab.com/group/subgroup/repo", Dir: "v2/cmd/cmdname"},
+			"v2.0.0",
+			[]string{
+				"https://gitlab.com/group/subgroup/repo/-/raw/v2.0.0/v2/cmd/cmdname/README.md",
+				"https://gitlab.com/group/subgroup/repo/-/raw/main/v2/cmd/cmdname/README.md",
+				"https://gitlab.com/group/subgroup/repo/-/raw/trunk/v2/cmd/cmdname/README.md",
+				"https://gitlab.com/group/subgroup/repo/-/raw/master/v2/cmd/cmdname/README.md",
+				"https://gitlab.com/group/subgroup/repo/v2/cmd/cmdname/README.md",
+			},
+			false},
+		{"sourcehut",
+			location{Root: "git.sr.ht/~user/repo", Dir: "cmd/cmdname"},
+			"",
+			[]string{
+				"https://git.sr.ht/~user/repo/blob/main/cmd/cmdname/README.md",
+				"https://git.sr.ht/~user/repo/blob/trunk/cmd/cmdname/README.md",
+				"https://git.sr.ht/~user/repo/blob/master/cmd/cmdname/README.md",
+				"https://git.sr.ht/~user/repo/cmd/cmdname/README.md",
 			},
 			false},
-		// TODO: all of the aboce with v2 repos
 		{"vanity",
-			"npf.io/gorram",
+			location{Root: "npf.io/gorram"},
+			"",
 			[]string{
-				"https://npf.io/gorram/", // TODO
+				"https://npf.io/gorram/README.md", // TODO
 			},
 			false},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := possibleReadmeURLs(tt.src, "") // TODO - also test version strings
+			got := possibleReadmeURLs(tt.loc, candidateRefs(tt.ref, ""), "README.md")
 			if len(got) != len(tt.want) {
 				t.Errorf("getRawReadmeURL(): %s\ngot \n%v\n want \n%v", tt.name, got, tt.want)
 			}
@@ -64,7 +119,54 @@ func Test_getReadmeURL(t *testing.T) {
 	}
 }
 
-// TODO: find a reasonable test of findLocalReadme()
+func Test_binInfoFrom(t *testing.T) {
+	tests := []struct {
+		name string
+		bi   debug.BuildInfo
+		want binInfo
+		ref  string
+	}{
+		{"release",
+			debug.BuildInfo{Path: "github.com/user/repo/cmd/tool", Main: debug.Module{Path: "github.com/user/repo", Version: "v1.2.3"}},
+			binInfo{Path: "github.com/user/repo/cmd/tool", Module: "github.com/user/repo", Version: "v1.2.3"},
+			"v1.2.3",
+		},
+		{"devel",
+			debug.BuildInfo{Path: "github.com/user/repo", Main: debug.Module{Path: "github.com/user/repo", Version: "(devel)"},
+				Settings: []debug.BuildSetting{
+					{Key: "-trimpath", Value: "true"},
+					{Key: "vcs", Value: "git"},
+					{Key: "vcs.revision", Value: "0123456789abcdef0123456789abcdef01234567"},
+					{Key: "vcs.time", Value: "2024-01-01T12:00:00Z"},
+					{Key: "vcs.modified", Value: "true"},
+				}},
+			binInfo{Path: "github.com/user/repo", Module: "github.com/user/repo",
+				VCS: "git", Revision: "0123456789abcdef0123456789abcdef01234567", Time: "2024-01-01T12:00:00Z", Modified: true},
+			"0123456789abcdef0123456789abcdef01234567",
+		},
+		{"pseudo-version with revision",
+			debug.BuildInfo{Path: "github.com/user/repo", Main: debug.Module{Path: "github.com/user/repo", Version: "v0.0.0-20240101120000-0123456789ab"},
+				Settings: []debug.BuildSetting{
+					{Key: "vcs", Value: "git"},
+					{Key: "vcs.revision", Value: "0123456789abcdef0123456789abcdef01234567"},
+				}},
+			binInfo{Path: "github.com/user/repo", Module: "github.com/user/repo", Version: "v0.0.0-20240101120000-0123456789ab",
+				VCS: "git", Revision: "0123456789abcdef0123456789abcdef01234567"},
+			"0123456789abcdef0123456789abcdef01234567",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := binInfoFrom(&tt.bi)
+			if got != tt.want {
+				t.Errorf("binInfoFrom()\ngot  %+v\nwant %+v", got, tt.want)
+			}
+			if got.ref("") != tt.ref {
+				t.Errorf("binInfo.ref() = %q, want %q", got.ref(""), tt.ref)
+			}
+		})
+	}
+}
 
 func Test_sources(t *testing.T) {
 	type args struct {
@@ -164,3 +266,161 @@ func Test_stripModVersion(t *testing.T) {
 		})
 	}
 }
+
+func Test_resolveArg(t *testing.T) {
+	defer func(v *bool, tr http.RoundTripper) {
+		verbose, httpClient.Transport = v, tr
+	}(verbose, httpClient.Transport)
+	verbose = new(bool)
+	httpClient.Transport = failTransport{t}
+
+	// The test binary is a Go binary with build info.
+	self, err := os.Executable()
+	if err != nil {
+		t.Skipf("cannot determine the test binary: %s", err)
+	}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		t.Skip("no build info in the test binary")
+	}
+	dir := t.TempDir()
+	for _, name := range []string{"tool@v1", filepath.Join("pkg@v1.2.0", "tool")} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(self, filepath.Join(dir, name)); err != nil {
+			t.Skipf("cannot link the test binary: %s", err)
+		}
+	}
+	t.Setenv("PATH", dir)
+
+	tests := []struct {
+		name string
+		exec string
+	}{
+		{"binary name with version", "tool@v1"},
+		{"binary path with version", filepath.Join(dir, "pkg@v1.2.0", "tool")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := resolveArg(tt.exec)
+			if !ok || got.Path != bi.Path {
+				t.Errorf("resolveArg(%q) = %+v, %v, want the binary's source %s", tt.exec, got, ok, bi.Path)
+			}
+		})
+	}
+}
+
+// failTransport fails the test on any HTTP request.
+type failTransport struct{ t *testing.T }
+
+func (f failTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	f.t.Errorf("unexpected request to %s", r.URL)
+	return nil, errOffline
+}
+
+func Test_findReadme_offline(t *testing.T) {
+	defer func(r, v, o *bool, c *cache, tr http.RoundTripper) {
+		remoteOnly, verbose, offline, readmeCache, httpClient.Transport = r, v, o, c, tr
+	}(remoteOnly, verbose, offline, readmeCache, httpClient.Transport)
+	remoteOnly, verbose, offline = new(bool), new(bool), new(bool)
+	*remoteOnly, *offline = true, true
+	httpClient.Transport = failTransport{t}
+	readmeCache = &cache{dir: t.TempDir()}
+	testModCache(t)
+	t.Setenv("GOPATH", t.TempDir())
+
+	defer func(ttl time.Duration) { cacheTTL = ttl }(cacheTTL)
+	cacheTTL = -time.Hour
+	if err := readmeCache.storeReadme(cacheEntry{Key: "example.com/cached@HEAD", Content: []byte("stale readme"), Source: "https://example.com/README.md"}, false); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		bi         binInfo
+		want       string
+		wantSource string
+		wantErr    bool
+	}{
+		{"module cache despite -r", binInfo{Path: "github.com/User/repo/cmd/tool", Module: "github.com/User/repo", Version: "v1.2.0"},
+			"v1.2.0 tool readme", "", false},
+		{"expired cache entry", binInfo{Path: "example.com/cached"},
+			"stale readme", "https://example.com/README.md (cached, expired)", false},
+		{"newest cached version", binInfo{Path: "github.com/User/repo", Module: "github.com/User/repo", Version: "v1.4.0"},
+			"v1.3.0 readme", "", false},
+		{"nothing local", binInfo{Path: "example.com/remote/tool", Module: "example.com/remote/tool", Version: "v1.0.0"},
+			"", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			readme, source, err := findReadme(tt.bi)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("findReadme() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if errors.Cause(err) != errOffline {
+					t.Errorf("findReadme() error = %v, want errOffline", err)
+				}
+				return
+			}
+			if string(readme) != tt.want {
+				t.Errorf("findReadme() = %q, want %q", readme, tt.want)
+			}
+			if tt.wantSource != "" && source != tt.wantSource {
+				t.Errorf("findReadme() source = %q, want %q", source, tt.wantSource)
+			}
+		})
+	}
+}
+
+// statusTransport answers every request with an empty response with the
+// given status code, or with err.
+type statusTransport struct {
+	status int
+	err    error
+}
+
+func (s statusTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &http.Response{StatusCode: s.status, Status: http.StatusText(s.status), Header: http.Header{}, Body: http.NoBody, Request: r}, nil
+}
+
+func Test_findReadme_negativeCache(t *testing.T) {
+	// A repository without README, which git fetches instead of GitHub.
+	gitTestRepo(t, "https://github.com/user/repo", map[string]string{"go.mod": "module github.com/user/repo\n", "cmd/tool/main.go": "package main\n"}, "v1.0.0")
+	t.Setenv("GOPROXY", "https://proxy.golang.org")
+
+	defer func(r, v, o *bool, c *cache, tr http.RoundTripper) {
+		remoteOnly, verbose, offline, readmeCache, httpClient.Transport = r, v, o, c, tr
+	}(remoteOnly, verbose, offline, readmeCache, httpClient.Transport)
+	remoteOnly, verbose, offline = new(bool), new(bool), new(bool)
+	*remoteOnly = true
+
+	bi := binInfo{Path: "github.com/user/repo/cmd/tool", Module: "github.com/user/repo", Version: "v1.0.0"}
+	key := cacheKey(bi.Path, bi)
+	tests := []struct {
+		name         string
+		transport    http.RoundTripper
+		wantNegative bool
+	}{
+		{"not found everywhere", statusTransport{status: http.StatusNotFound}, true},
+		{"network down", statusTransport{err: errors.Wrap(syscall.ECONNREFUSED, "dial tcp")}, false},
+		{"server error", statusTransport{status: http.StatusInternalServerError}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			readmeCache = &cache{dir: t.TempDir()}
+			httpClient.Transport = tt.transport
+			if _, _, err := findReadme(bi); err == nil {
+				t.Fatal("findReadme() found a README, want an error")
+			}
+			e, ok := readmeCache.get(key)
+			if ok != tt.wantNegative || ok && !e.Negative {
+				t.Errorf("cache entry = %+v, %v, want a negative entry: %v", e, ok, tt.wantNegative)
+			}
+		})
+	}
+}
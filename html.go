@@ -0,0 +1,250 @@
+// (C) 2017 Christoph Berger <mail@christophberger.com>. Some rights reserved.
+// Distributed under a 3-clause BSD license; see LICENSE.txt.
+
+package main
+
+import (
+	"bytes"
+	"mime"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// readmeContainers are the elements that contain a rendered README
+// on the web pages of repository browsers, in order of priority.
+var readmeContainers = []struct {
+	tag   atom.Atom
+	id    string
+	class string
+}{
+	{atom.Div, "summary", ""},           // cgit "about" page
+	{atom.Div, "", "readme"},            // gitweb project summary
+	{atom.Article, "", "markdown-body"}, // GitHub
+	{atom.Div, "", "markdown"},          // Gitea, Forgejo
+}
+
+// isHTML reports whether a response body is an HTML page. It goes by the
+// Content-Type header, and sniffs the body if the header is missing or
+// generic. (A README.md that starts with HTML tags served as text/plain
+// is no HTML page.)
+func isHTML(contentType string, body []byte) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "text/html", "application/xhtml+xml":
+		return true
+	case "", "application/octet-stream":
+		start := bytes.ToLower(bytes.TrimSpace(body[:min(len(body), 512)]))
+		return bytes.HasPrefix(start, []byte("<!doctype html")) || bytes.HasPrefix(start, []byte("<html"))
+	}
+	return false
+}
+
+// readmeFromHTML extracts a rendered README from an HTML page, like the
+// "about" page of cgit, and converts it to Markdown. Other pages, like
+// landing pages, error pages, or login pages, are no README and
+// result in an error.
+func readmeFromHTML(page []byte) ([]byte, error) {
+	doc, err := html.Parse(bytes.NewReader(page))
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot parse HTML page")
+	}
+
+	for _, c := range readmeContainers {
+		if n := findElement(doc, c.tag, c.id, c.class); n != nil {
+			var w markdownWriter
+			w.node(n)
+			return w.bytes(), nil
+		}
+	}
+
+	if hasPasswordInput(doc) {
+		return nil, errors.New("received a login page instead of a README (are the credentials missing?)")
+	}
+	return nil, errors.New("received an HTML page instead of a README")
+}
+
+// findElement returns the first element in n's tree with the given tag
+// and, if not empty, the given id and class.
+func findElement(n *html.Node, tag atom.Atom, id, class string) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == tag &&
+		(id == "" || attr(n, "id") == id) &&
+		(class == "" || hasClass(n, class)) {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, tag, id, class); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// hasPasswordInput reports whether n's tree contains a password field.
+func hasPasswordInput(n *html.Node) bool {
+	if n.Type == html.ElementNode && n.DataAtom == atom.Input && strings.EqualFold(attr(n, "type"), "password") {
+		return true
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if hasPasswordInput(c) {
+			return true
+		}
+	}
+	return false
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasClass(n *html.Node, class string) bool {
+	for _, c := range strings.Fields(attr(n, "class")) {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// markdownWriter converts HTML to Markdown. It knows the elements that
+// README files typically consist of, and keeps the text of all others.
+type markdownWriter struct {
+	buf   strings.Builder
+	pre   bool     // inside <pre>
+	lists []string // list item markers of the enclosing lists
+}
+
+var (
+	trailingSpaceRe = regexp.MustCompile(`(?m)[ \t]+$`)
+	blankLinesRe    = regexp.MustCompile(`\n\n\n+`)
+)
+
+func (w *markdownWriter) bytes() []byte {
+	s := trailingSpaceRe.ReplaceAllString(w.buf.String(), "")
+	s = blankLinesRe.ReplaceAllString(s, "\n\n")
+	return []byte(strings.TrimSpace(s) + "\n")
+}
+
+func (w *markdownWriter) children(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		w.node(c)
+	}
+}
+
+func (w *markdownWriter) node(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		w.text(n.Data)
+		return
+	case html.ElementNode:
+	default:
+		w.children(n)
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.Script, atom.Style, atom.Nav, atom.Button, atom.Form, atom.Svg:
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		level := int(n.Data[1] - '0')
+		w.buf.WriteString("\n\n" + strings.Repeat("#", level) + " ")
+		w.children(n)
+		w.buf.WriteString("\n\n")
+	case atom.P, atom.Div, atom.Table, atom.Blockquote, atom.Section, atom.Article:
+		w.buf.WriteString("\n\n")
+		w.children(n)
+		w.buf.WriteString("\n\n")
+	case atom.Tr:
+		w.buf.WriteString("\n")
+		w.children(n)
+	case atom.Td, atom.Th:
+		w.children(n)
+		w.buf.WriteString(" ")
+	case atom.Br:
+		w.buf.WriteString("\n")
+	case atom.Hr:
+		w.buf.WriteString("\n\n---\n\n")
+	case atom.Ul, atom.Ol:
+		marker := "- "
+		if n.DataAtom == atom.Ol {
+			marker = "1. "
+		}
+		w.lists = append(w.lists, marker)
+		w.children(n)
+		w.lists = w.lists[:len(w.lists)-1]
+		if len(w.lists) == 0 {
+			w.buf.WriteString("\n\n")
+		}
+	case atom.Li:
+		indent, marker := "", "- "
+		if len(w.lists) > 0 {
+			indent = strings.Repeat("    ", len(w.lists)-1)
+			marker = w.lists[len(w.lists)-1]
+		}
+		w.buf.WriteString("\n" + indent + marker)
+		w.children(n)
+	case atom.Pre:
+		code := markdownWriter{pre: true}
+		code.children(n)
+		w.buf.WriteString("\n\n```\n" + strings.TrimRight(code.buf.String(), "\n") + "\n```\n\n")
+	case atom.Code:
+		if w.pre {
+			w.children(n)
+			return
+		}
+		w.buf.WriteString("`")
+		w.children(n)
+		w.buf.WriteString("`")
+	case atom.Strong, atom.B:
+		w.buf.WriteString("**")
+		w.children(n)
+		w.buf.WriteString("**")
+	case atom.Em, atom.I:
+		w.buf.WriteString("*")
+		w.children(n)
+		w.buf.WriteString("*")
+	case atom.A:
+		href := attr(n, "href")
+		if !strings.HasPrefix(href, "https://") && !strings.HasPrefix(href, "http://") {
+			w.children(n)
+			return
+		}
+		w.buf.WriteString("[")
+		w.children(n)
+		w.buf.WriteString("](" + href + ")")
+	case atom.Img:
+		w.buf.WriteString(attr(n, "alt"))
+	default:
+		w.children(n)
+	}
+}
+
+// text writes a text node. Outside of <pre>, whitespace collapses
+// to a single space, as in the browser.
+func (w *markdownWriter) text(s string) {
+	if w.pre {
+		w.buf.WriteString(s)
+		return
+	}
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		if s != "" {
+			w.buf.WriteString(" ")
+		}
+		return
+	}
+	if strings.TrimLeft(s, " \t\r\n") != s {
+		w.buf.WriteString(" ")
+	}
+	w.buf.WriteString(strings.Join(fields, " "))
+	if strings.TrimRight(s, " \t\r\n") != s {
+		w.buf.WriteString(" ")
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const cgitAboutPage = `<!DOCTYPE html>
+<html lang='en'>
+<head><title>tool - A tool</title></head>
+<body>
+<div id='cgit'><table id='header'><tr><td class='main'>tool</td></tr></table>
+<table class='tabs'><tr><td><a class='active' href='/tool/about/'>about</a><a href='/tool/'>summary</a></td></tr></table>
+<div class='content'><div id='summary'>
+<h1>Tool</h1>
+<p>Tool does <strong>things</strong>
+   with <a href="https://example.com/docs">files</a>.</p>
+<h2>Usage</h2>
+<pre><code>tool -v file
+tool -h
+</code></pre>
+<ul>
+<li>fast</li>
+<li>small<ul><li>really</li></ul></li>
+</ul>
+</div>
+</div>
+</div>
+</body>
+</html>`
+
+const cgitAboutMarkdown = "# Tool\n\nTool does **things** with [files](https://example.com/docs).\n\n## Usage\n\n```\ntool -v file\ntool -h\n```\n\n- fast\n- small\n    - really\n"
+
+const gitwebSummaryPage = `<?xml version="1.0" encoding="utf-8"?>
+<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Strict//EN" "http://www.w3.org/TR/xhtml1/DTD/xhtml1-strict.dtd">
+<html xmlns="http://www.w3.org/1999/xhtml" xml:lang="en-US" lang="en-US">
+<body>
+<div class="page_header"><a href="/">projects</a> / tool.git / summary</div>
+<div class="title">readme</div>
+<div class="readme">
+<p>The <em>tool</em> README.</p>
+</div>
+<div class="title">shortlog</div>
+</body>
+</html>`
+
+const loginPage = `<!doctype html>
+<html><body><form action="/login" method="post">
+<h1>Sign in</h1>
+<input type="text" name="user"><input type="password" name="password">
+</form></body></html>`
+
+const landingPage = `<html><head><title>Example Inc.</title></head>
+<body><h1>Welcome to Example Inc.</h1><p>We make tools.</p></body></html>`
+
+func Test_isHTML(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        bool
+	}{
+		{"html", "text/html; charset=utf-8", "<p>hi</p>", true},
+		{"xhtml", "application/xhtml+xml", "", true},
+		{"plain markdown with html", "text/plain; charset=utf-8", `<p align="center"><img src="logo.png"></p>`, false},
+		{"markdown", "text/markdown", "# Title", false},
+		{"no content type, html", "", "\n  <!DOCTYPE html><html></html>", true},
+		{"octet-stream, html", "application/octet-stream", "<HTML><BODY></BODY></HTML>", true},
+		{"octet-stream, readme", "application/octet-stream", "<h1>Title</h1>", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isHTML(tt.contentType, []byte(tt.body)); got != tt.want {
+				t.Errorf("isHTML() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_readmeFromHTML(t *testing.T) {
+	tests := []struct {
+		name    string
+		page    string
+		want    string
+		wantErr string
+	}{
+		{"cgit about", cgitAboutPage, cgitAboutMarkdown, ""},
+		{"gitweb summary", gitwebSummaryPage, "The *tool* README.\n", ""},
+		{"login page", loginPage, "", "login page"},
+		{"landing page", landingPage, "", "HTML page"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readmeFromHTML([]byte(tt.page))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("readmeFromHTML() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readmeFromHTML() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("readmeFromHTML()\ngot  %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_httpGetReadme_html(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/about/":
+			w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+			_, _ = w.Write([]byte(gitwebSummaryPage))
+		case "/login":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte(loginPage))
+		case "/README.md":
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			_, _ = w.Write([]byte(`<p align="center">Tool</p>`))
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{"/about/", "The *tool* README.\n", false},
+		{"/login", "", true},
+		{"/README.md", `<p align="center">Tool</p>`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := httpGetReadme(context.Background(), srv.URL+tt.path, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("httpGetReadme() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if string(got.Content) != tt.want {
+				t.Errorf("httpGetReadme() = %q, want %q", got.Content, tt.want)
+			}
+		})
+	}
+}
+
+func Test_findRemoteReadme_aboutPage(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.RequestURI() {
+		case "/tool/about/":
+			w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+			_, _ = w.Write([]byte(cgitAboutPage))
+		case "/?p=tools/tool.git;a=summary":
+			w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+			_, _ = w.Write([]byte(gitwebSummaryPage))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	defer func(c *http.Client, f []forge, v *bool) { httpClient, forges, verbose = c, f, v }(httpClient, forges, verbose)
+	httpClient = &http.Client{Transport: toServer{u}}
+	verbose = new(bool)
+	_ = registerForge("cgit", "cgit.example.com", "")
+	_ = registerForge("gitweb", "gitweb.example.com", "")
+
+	tests := []struct {
+		root    string
+		want    string
+		wantURL string
+	}{
+		{"cgit.example.com/tool", cgitAboutMarkdown, "https://cgit.example.com/tool/about/"},
+		{"gitweb.example.com/tools/tool", "The *tool* README.\n", "https://gitweb.example.com/?p=tools/tool.git;a=summary"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.root, func(t *testing.T) {
+			readme, source, exact, err := findRemoteReadme([]location{{Root: tt.root, Dir: "cmd/tool"}, {Root: tt.root}}, "v1.0.0")
+			if err != nil {
+				t.Fatalf("findRemoteReadme() error = %v", err)
+			}
+			if string(readme.Content) != tt.want || source != tt.wantURL || exact {
+				t.Errorf("findRemoteReadme() = %q, %s, %v, want %q, %s, false", readme.Content, source, exact, tt.want, tt.wantURL)
+			}
+		})
+	}
+}
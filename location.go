@@ -0,0 +1,128 @@
+// (C) 2017 Christoph Berger <mail@christophberger.com>. Some rights reserved.
+// Distributed under a 3-clause BSD license; see LICENSE.txt.
+
+package main
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+var majorSuffixRe = regexp.MustCompile(`/v\d+$`)
+
+// location is a directory in a source repository that may contain the README.
+type location struct {
+	Root string // repository root without scheme, e.g. gitlab.com/group/subgroup/project
+	Dir  string // slash-separated directory below Root; empty for the root itself
+}
+
+// String returns the location as a single path, e.g. github.com/user/repo/cmd/tool.
+func (l location) String() string {
+	return path.Join(l.Root, l.Dir)
+}
+
+// repository describes where a module lives in its source repository.
+type repository struct {
+	Root   string // repository root without scheme, e.g. github.com/user/repo
+	Subdir string // module directory within the repository, without major version suffix
+	Major  string // major version suffix of the module path, e.g. "v2"; empty for v0 and v1
+	URL    string // URL for cloning the repository, if it is not https://<Root>
+	VCS    string // version control system from the go-import meta tag; empty means git
+	// Configured is true if URL comes from the configuration file rather
+	// than from a go-import meta tag, and may thus be a file:// URL.
+	Configured bool
+}
+
+// cloneURL returns the URL for cloning the repository.
+func (r repository) cloneURL() string {
+	if r.URL != "" {
+		return r.URL
+	}
+	return "https://" + r.Root
+}
+
+// moduleRepository derives the repository of module mod from the module path.
+// On forges with a fixed depth (see fixedDepthForge), including the ones from
+// the configuration file, the repository root consists of the host and the
+// owner and project elements, and anything below is the module's subdirectory.
+// On all other hosts (think GitLab with nested groups), the repository root
+// cannot be derived from the path, and moduleRepository assumes that the module
+// lives at the repository root.
+func moduleRepository(mod string) repository {
+	root, major := splitMajor(mod)
+	if f, ok := forgeFor(root).(fixedDepthForge); ok {
+		n := 1 + f.depth()
+		dirs := strings.Split(root, "/")
+		if len(dirs) > n {
+			return repository{Root: strings.Join(dirs[:n], "/"), Subdir: strings.Join(dirs[n:], "/"), Major: major}
+		}
+	}
+	return repository{Root: root, Major: major}
+}
+
+// splitMajor splits a module path into the path without the major version
+// suffix, and the suffix itself (without the slash).
+//
+// Example:
+//
+// github.com/user/repo/v2 => github.com/user/repo, v2
+func splitMajor(mod string) (string, string) {
+	loc := majorSuffixRe.FindStringIndex(mod)
+	if loc == nil {
+		return mod, ""
+	}
+	return mod[:loc[0]], mod[loc[0]+1:]
+}
+
+// locations returns the candidate README locations for the package in
+// directory rel of the module, walking from the package directory up to the
+// module root. For modules with a major version suffix, the module can either
+// live in a subdirectory named after the major version, or at the root of a
+// branch. The location for the major subdirectory comes first.
+//
+// Example:
+//
+// Module github.com/user/repo/v2, rel = cmd/tool, returns locations within
+// the repository github.com/user/repo for the directories
+// v2/cmd/tool, cmd/tool, v2/cmd, cmd, v2, and the root.
+func (r repository) locations(rel string) []location {
+	var locs []location
+	for {
+		if r.Major != "" {
+			locs = append(locs, location{Root: r.Root, Dir: path.Join(r.Subdir, r.Major, rel)})
+		}
+		locs = append(locs, location{Root: r.Root, Dir: path.Join(r.Subdir, rel)})
+		if rel == "" {
+			return locs
+		}
+		rel = path.Dir(rel)
+		if rel == "." {
+			rel = ""
+		}
+	}
+}
+
+// heuristicLocations returns the candidate README locations for binaries
+// that have no module information. It takes the paths that sources derives
+// from the major version heuristics, and assumes that the repository root
+// consists of the first three elements of each path.
+func heuristicLocations(src string) []location {
+	var locs []location
+	for _, s := range sources(src) {
+		dirs := strings.Split(s, "/")
+		n := min(len(dirs), 3)
+		locs = append(locs, location{Root: strings.Join(dirs[:n], "/"), Dir: strings.Join(dirs[n:], "/")})
+	}
+	return locs
+}
+
+// importPaths converts locations to import path-like strings,
+// as needed for searching the README in the GOPATH.
+func importPaths(locs []location) []string {
+	paths := make([]string, len(locs))
+	for i, l := range locs {
+		paths[i] = l.String()
+	}
+	return paths
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_moduleRepository(t *testing.T) {
+	defer func(f []forge) { forges = f }(forges)
+	_ = registerForge("forgejo", "forgejo.example.com", "")
+	_ = registerForge("gitlab", "gitlab.example.com", "")
+
+	tests := []struct {
+		name string
+		mod  string
+		want repository
+	}{
+		{"github", "github.com/user/repo", repository{Root: "github.com/user/repo"}},
+		{"githubv2", "github.com/user/repo/v2", repository{Root: "github.com/user/repo", Major: "v2"}},
+		{"githubsubmodule", "github.com/user/repo/tools/v3", repository{Root: "github.com/user/repo", Subdir: "tools", Major: "v3"}},
+		{"sourcehut", "git.sr.ht/~user/repo", repository{Root: "git.sr.ht/~user/repo"}},
+		{"sourcehutsubmodule", "hg.sr.ht/~user/repo/tools", repository{Root: "hg.sr.ht/~user/repo", Subdir: "tools"}},
+		{"codebergsubmodule", "codeberg.org/user/repo/tools/v2", repository{Root: "codeberg.org/user/repo", Subdir: "tools", Major: "v2"}},
+		{"gitlabnested", "gitlab.com/group/subgroup/repo/v2", repository{Root: "gitlab.com/group/subgroup/repo", Major: "v2"}},
+		{"gitea", "gitea.example.com/user/repo", repository{Root: "gitea.example.com/user/repo"}},
+		{"configured forgejo submodule", "forgejo.example.com/user/repo/tools/v2", repository{Root: "forgejo.example.com/user/repo", Subdir: "tools", Major: "v2"}},
+		{"configured gitlab", "gitlab.example.com/group/sub/repo/tools", repository{Root: "gitlab.example.com/group/sub/repo/tools"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := moduleRepository(tt.mod); got != tt.want {
+				t.Errorf("moduleRepository(%q) = %+v, want %+v", tt.mod, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_repository_locations(t *testing.T) {
+	tests := []struct {
+		name string
+		repo repository
+		rel  string
+		want []location
+	}{
+		{"root", repository{Root: "github.com/user/repo"}, "",
+			[]location{{"github.com/user/repo", ""}},
+		},
+		{"cmd", repository{Root: "gitlab.com/group/subgroup/repo"}, "cmd/tool",
+			[]location{
+				{"gitlab.com/group/subgroup/repo", "cmd/tool"},
+				{"gitlab.com/group/subgroup/repo", "cmd"},
+				{"gitlab.com/group/subgroup/repo", ""},
+			},
+		},
+		{"v2", repository{Root: "github.com/user/repo", Major: "v2"}, "cmd/tool",
+			[]location{
+				{"github.com/user/repo", "v2/cmd/tool"},
+				{"github.com/user/repo", "cmd/tool"},
+				{"github.com/user/repo", "v2/cmd"},
+				{"github.com/user/repo", "cmd"},
+				{"github.com/user/repo", "v2"},
+				{"github.com/user/repo", ""},
+			},
+		},
+		{"submodule", repository{Root: "go.googlesource.com/tools", Subdir: "gopls"}, "",
+			[]location{{"go.googlesource.com/tools", "gopls"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.repo.locations(tt.rel); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("locations(%q)\ngot  %v\nwant %v", tt.rel, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_heuristicLocations(t *testing.T) {
+	got := heuristicLocations("github.com/user/repo/v2/cmd/name")
+	want := []location{
+		{"github.com/user/repo", "v2/cmd/name"},
+		{"github.com/user/repo", "cmd/name"},
+		{"github.com/user/repo", "v2"},
+		{"github.com/user/repo", ""},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("heuristicLocations()\ngot  %v\nwant %v", got, want)
+	}
+}
@@ -12,44 +12,102 @@
 // or
 //
 //     goman <go binary file> | less -R
+//
+// or, for a module or package that is not installed,
+//
+//     goman <module or package path>[@version]
+//
+// The README cache can be inspected and cleaned with
+//
+//     goman cache ls|clear|prune
 package main
 
 import (
+	_ "embed"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
 	"runtime/debug"
+	"strings"
 	"syscall"
+
+	"github.com/pkg/errors"
 )
 
+// embeddedReadme is goman's own README, for `goman help` in offline mode.
+//
+//go:embed README.md
+var embeddedReadme []byte
+
 func usage() {
 	fmt.Print(`Usage:
 
 goman <name of Go binary>
+goman <module or package path>[@version]
+goman cache ls|clear|prune
 
 goman is man for Go binaries. It attempts to fetch the README file of a Go binary's project and displays it in the terminal, if found.
+The version of a module or package path can be latest (the default), a version prefix like v1, a range like <v2.0.0, a version, or a branch or commit.
 
 `)
 	flag.Usage()
+	fmt.Println("\nDefault flags can be set in the environment variable GOMANFLAGS, e.g. GOMANFLAGS=-offline")
 	b, _ := debug.ReadBuildInfo()
 	fmt.Printf("\nModule info: %s %s\n", b.Main.Path, b.Main.Version)
+	fmt.Printf("Configuration file: %s\n", configPath())
 }
 
 var (
 	remoteOnly *bool
 	verbose    *bool
+	offline    *bool
 )
 
 func main() {
 
 	log.SetFlags(0)
 
+	c, err := loadConfig(configPath())
+	if err == nil {
+		err = c.apply()
+	}
+	if err != nil {
+		log.Fatalln(err)
+	}
+
 	verbose = flag.Bool("v", false, "Verbose error output")
-	remoteOnly = flag.Bool("r", false, "Skip local search (as the local file may be outdated)")
+	remoteOnly = flag.Bool("r", cfg.RemoteOnly, "Skip local search (as the local file may be outdated)")
+	offline = flag.Bool("offline", false, "Search local sources and the README cache only; never access the network (implied by GOPROXY=off)")
+	if err := setFlagsFromEnv("GOMANFLAGS"); err != nil {
+		log.Fatalln(err)
+	}
 	flag.Parse()
 
+	if !*offline && goproxyOff() {
+		*offline = true
+		if *verbose {
+			log.Println("GOPROXY=off: switching to offline mode")
+		}
+	}
+	if *offline {
+		httpClient.Transport = offlineTransport{}
+	}
+
+	if c, err := newCache(); err == nil {
+		readmeCache = c
+	} else if *verbose {
+		log.Println(err)
+	}
+
+	if len(flag.Args()) == 2 && flag.Args()[0] == "cache" {
+		if err := runCacheCommand(readmeCache, flag.Args()[1]); err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+
 	if len(flag.Args()) != 1 {
 		usage()
 		return
@@ -57,10 +115,9 @@ func main() {
 	switch flag.Args()[0] {
 	// easier than defining four flags and checking for the string "help" also:
 	case "-h", "-help", "--help", "-?", "help":
-		readme, _, err := findReadme("github.com/appliedgocode/goman", "")
+		readme, _, err := findReadme(binInfo{Path: "github.com/appliedgocode/goman"})
 		if err != nil {
-			usage()
-			return
+			readme = embeddedReadme
 		}
 		fmt.Println(string(mdToAnsi(readme)))
 		return
@@ -73,6 +130,25 @@ func main() {
 	run(exec)
 }
 
+// setFlagsFromEnv sets flags from the environment variable env, like the
+// go command does with GOFLAGS: The variable contains a space-separated list
+// of -flag or -flag=value settings. Flags on the command line take precedence.
+func setFlagsFromEnv(env string) error {
+	for _, f := range strings.Fields(os.Getenv(env)) {
+		if !strings.HasPrefix(f, "-") {
+			return errors.Errorf("%s: flag %q does not begin with -", env, f)
+		}
+		name, value, ok := strings.Cut(strings.TrimLeft(f, "-"), "=")
+		if !ok {
+			value = "true"
+		}
+		if err := flag.Set(name, value); err != nil {
+			return errors.Wrapf(err, "%s: invalid flag %s", env, f)
+		}
+	}
+	return nil
+}
+
 // In case goman gets stuck somewhere. This should not happen under normal circumstances.
 // There are no resources to be cleaned up, so we just exit.
 func exitOnSignal() {
@@ -0,0 +1,164 @@
+// (C) 2017 Christoph Berger <mail@christophberger.com>. Some rights reserved.
+// Distributed under a 3-clause BSD license; see LICENSE.txt.
+
+package main
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// gomodcache returns the directory of the module cache, as defined by
+// GOMODCACHE, or the default location $GOPATH/pkg/mod.
+func gomodcache() string {
+	if dir := goEnv("GOMODCACHE"); dir != "" {
+		return dir
+	}
+	return filepath.Join(gopath()[0], "pkg", "mod")
+}
+
+// findModCacheReadme searches the module cache for the README of package pkg
+// in module mod at version ver. The module cache stores extracted modules at
+//
+//	<GOMODCACHE>/<escaped module path>@<escaped version>/
+//
+// and the downloaded zip files at
+//
+//	<GOMODCACHE>/cache/download/<escaped module path>/@v/<escaped version>.zip
+//
+// where escaping replaces each upper-case letter by an exclamation mark followed
+// by the lower-case letter. findModCacheReadme tries the extracted directory first,
+// and then reads the README straight out of the zip file.
+func findModCacheReadme(pkg, mod, ver string) (readme []byte, fp string, err error) {
+
+	escMod, err := module.EscapePath(mod)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "invalid module path "+mod)
+	}
+	escVer, err := module.EscapeVersion(ver)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "invalid module version "+ver)
+	}
+
+	cache := gomodcache()
+	dir := pkgDir(pkg, mod)
+
+	root := filepath.Join(cache, filepath.FromSlash(escMod)+"@"+escVer)
+	readme, fp, err = readmeFromDir(root, dir)
+	if err == nil {
+		return readme, fp, nil
+	}
+
+	zipPath := filepath.Join(cache, "cache", "download", filepath.FromSlash(escMod), "@v", escVer+".zip")
+	f, err := os.Open(zipPath)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "module %s@%s not found in the module cache", mod, ver)
+	}
+	defer f.Close()
+
+	zr, err := zipReader(f)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "cannot read module zip file "+zipPath)
+	}
+	readme, name, err := readmeFromZip(zr, mod+"@"+ver, dir)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "no README in "+zipPath)
+	}
+	return readme, zipPath + "#" + name, nil
+}
+
+// findNewestCachedReadme is the last resort if the README at the installed
+// version is neither in the module cache nor remotely available.
+// It searches the newest version of module mod in the module cache,
+// except for version `skip`, which was already searched for.
+// The returned source tells that the README is from a different version.
+func findNewestCachedReadme(pkg, mod, skip string) (readme []byte, source string, err error) {
+
+	err = errors.New("no cached versions of module " + mod)
+	for _, ver := range cachedVersions(mod) {
+		if ver == skip {
+			continue
+		}
+		readme, source, err = findModCacheReadme(pkg, mod, ver)
+		if err != nil {
+			continue
+		}
+		installed := skip
+		if installed == "" {
+			installed = "unknown"
+		}
+		return readme, source + " - from the newest cached version " + ver + ", the installed version is " + installed, nil
+	}
+	return nil, "", err
+}
+
+// cachedVersions returns the versions of module mod that are available
+// in the module cache, either extracted or as zip file, newest first.
+func cachedVersions(mod string) []string {
+
+	escMod, err := module.EscapePath(mod)
+	if err != nil {
+		return nil
+	}
+	cache := gomodcache()
+	seen := map[string]bool{}
+	var versions []string
+	add := func(escVer string) {
+		ver, err := module.UnescapeVersion(escVer)
+		if err != nil || !semver.IsValid(ver) || seen[ver] {
+			return
+		}
+		seen[ver] = true
+		versions = append(versions, ver)
+	}
+
+	// Extracted modules: <cache>/<escaped parent path>/<escaped last element>@<version>
+	parent, last := path.Split(escMod)
+	entries, _ := os.ReadDir(filepath.Join(cache, filepath.FromSlash(parent)))
+	for _, e := range entries {
+		if e.IsDir() && strings.HasPrefix(e.Name(), last+"@") {
+			add(strings.TrimPrefix(e.Name(), last+"@"))
+		}
+	}
+
+	// Zip files: <cache>/cache/download/<escaped module path>/@v/<version>.zip
+	entries, _ = os.ReadDir(filepath.Join(cache, "cache", "download", filepath.FromSlash(escMod), "@v"))
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".zip") {
+			add(strings.TrimSuffix(e.Name(), ".zip"))
+		}
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return semver.Compare(versions[i], versions[j]) > 0
+	})
+	return versions
+}
+
+// readmeFromDir finds the README file in directory dir below root.
+// If dir contains no README, readmeFromDir walks up to root.
+func readmeFromDir(root, dir string) ([]byte, string, error) {
+	for {
+		for _, name := range names {
+			fp := filepath.Join(root, filepath.FromSlash(dir), name)
+			readme, err := readFileReadme(fp)
+			if err == nil {
+				return readme, fp, nil
+			}
+		}
+		if dir == "" {
+			return nil, "", errors.New("no README file found in " + root)
+		}
+		dir = path.Dir(dir)
+		if dir == "." {
+			dir = ""
+		}
+	}
+}
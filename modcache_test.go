@@ -0,0 +1,127 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeFiles creates the files (given as slash-separated paths relative to root) with their content.
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		fp := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fp), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fp, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// testModCache sets up a module cache with module github.com/User/repo
+// extracted at v1.2.0 and downloaded as zip file at v1.3.0.
+func testModCache(t *testing.T) {
+	t.Helper()
+	cache := t.TempDir()
+	t.Setenv("GOMODCACHE", cache)
+	writeFiles(t, cache, map[string]string{
+		"github.com/!user/repo@v1.2.0/README.md":             "v1.2.0 readme",
+		"github.com/!user/repo@v1.2.0/cmd/tool/README":       "v1.2.0 tool readme",
+		"github.com/!user/repo@v1.2.0/cmd/other/main.go":     "package main",
+		"github.com/!user/repo@v1.10.0-rc.1/go.mod":          "module github.com/User/repo",
+		"github.com/!user/other@v9.0.0/README.md":            "other module",
+		"cache/download/github.com/!user/repo/@v/list":       "v1.2.0\nv1.3.0\n",
+		"cache/download/github.com/!user/repo/@v/v1.3.0.mod": "module github.com/User/repo",
+	})
+	zipFile := moduleZip(t, "github.com/User/repo@v1.3.0", map[string]string{
+		"README.md":          "v1.3.0 readme",
+		"cmd/tool/README.md": "v1.3.0 tool readme",
+	})
+	writeFiles(t, cache, map[string]string{
+		"cache/download/github.com/!user/repo/@v/v1.3.0.zip": string(zipFile),
+	})
+}
+
+func Test_findModCacheReadme(t *testing.T) {
+	testModCache(t)
+
+	tests := []struct {
+		name       string
+		pkg        string
+		ver        string
+		want       string
+		wantSource string
+		wantErr    bool
+	}{
+		{"extracted", "github.com/User/repo/cmd/tool", "v1.2.0", "v1.2.0 tool readme", "github.com/!user/repo@v1.2.0/cmd/tool/README", false},
+		{"extracted walk up", "github.com/User/repo/cmd/other", "v1.2.0", "v1.2.0 readme", "github.com/!user/repo@v1.2.0/README.md", false},
+		{"zip", "github.com/User/repo/cmd/tool", "v1.3.0", "v1.3.0 tool readme", "v1.3.0.zip#github.com/User/repo@v1.3.0/cmd/tool/README.md", false},
+		{"zip walk up", "github.com/User/repo/cmd/other", "v1.3.0", "v1.3.0 readme", "v1.3.0.zip#github.com/User/repo@v1.3.0/README.md", false},
+		{"not cached", "github.com/User/repo", "v1.4.0", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			readme, source, err := findModCacheReadme(tt.pkg, "github.com/User/repo", tt.ver)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("findModCacheReadme() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if string(readme) != tt.want {
+				t.Errorf("findModCacheReadme() = %q, want %q", readme, tt.want)
+			}
+			if !strings.HasSuffix(filepath.ToSlash(source), tt.wantSource) {
+				t.Errorf("findModCacheReadme() source = %s, want suffix %s", source, tt.wantSource)
+			}
+		})
+	}
+}
+
+func Test_cachedVersions(t *testing.T) {
+	testModCache(t)
+	want := []string{"v1.10.0-rc.1", "v1.3.0", "v1.2.0"}
+	if got := cachedVersions("github.com/User/repo"); !reflect.DeepEqual(got, want) {
+		t.Errorf("cachedVersions() = %v, want %v", got, want)
+	}
+}
+
+func Test_findNewestCachedReadme(t *testing.T) {
+	testModCache(t)
+
+	// v1.10.0-rc.1 has no README, so v1.3.0 is the newest version that has one.
+	readme, source, err := findNewestCachedReadme("github.com/User/repo/cmd/tool", "github.com/User/repo", "v1.4.0")
+	if err != nil {
+		t.Fatalf("findNewestCachedReadme(): %v", err)
+	}
+	if string(readme) != "v1.3.0 tool readme" {
+		t.Errorf("findNewestCachedReadme() = %q, want the README of v1.3.0", readme)
+	}
+	if !strings.Contains(source, "newest cached version v1.3.0, the installed version is v1.4.0") {
+		t.Errorf("findNewestCachedReadme() source = %s does not flag the version mismatch", source)
+	}
+
+	if _, _, err := findNewestCachedReadme("example.com/none", "example.com/none", ""); err == nil {
+		t.Errorf("findNewestCachedReadme() found a README for an uncached module")
+	}
+}
+
+func Test_findLocalReadme(t *testing.T) {
+	testModCache(t)
+	gp := t.TempDir()
+	t.Setenv("GOPATH", gp)
+	writeFiles(t, gp, map[string]string{
+		"src/example.com/user/repo/README.md": "gopath readme",
+	})
+
+	readme, _, err := findLocalReadme("github.com/User/repo/cmd/tool", "github.com/User/repo", "v1.2.0")
+	if err != nil || string(readme) != "v1.2.0 tool readme" {
+		t.Errorf("findLocalReadme() = %q, %v, want the README from the module cache", readme, err)
+	}
+
+	readme, _, err = findLocalReadme("example.com/user/repo/cmd/tool", "", "")
+	if err != nil || string(readme) != "gopath readme" {
+		t.Errorf("findLocalReadme() = %q, %v, want the README from GOPATH", readme, err)
+	}
+}
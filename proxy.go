@@ -0,0 +1,354 @@
+// (C) 2017 Christoph Berger <mail@christophberger.com>. Some rights reserved.
+// Distributed under a 3-clause BSD license; see LICENSE.txt.
+
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/mod/module"
+	modzip "golang.org/x/mod/zip"
+)
+
+const defaultGoproxy = "https://proxy.golang.org,direct"
+
+// maxZipSize is the maximum size of a module zip file in bytes,
+// which is the limit that the go command enforces, too.
+var maxZipSize int64 = modzip.MaxZipFile
+
+// minZipRate is the lowest download rate for module zip files, in bytes per
+// second, that zipClient allows for.
+var minZipRate int64 = 1 << 20
+
+var (
+	errProxyOff    = errors.New("module lookup disabled by GOPROXY=off")
+	errProxyDirect = errors.New("GOPROXY requests direct access to the repository")
+)
+
+// proxySpec is one entry of the GOPROXY list.
+type proxySpec struct {
+	url string
+	// fallBackOnError is true if the next proxy shall be tried after any error.
+	// (Entries separated by "|".) Otherwise, the next proxy is only tried
+	// after a "404 Not Found" or "410 Gone" response. (Entries separated by ",".)
+	fallBackOnError bool
+}
+
+// errNotFound is returned by a proxy that has no such module or version.
+type errNotFound struct {
+	msg string
+}
+
+func (e errNotFound) Error() string {
+	return e.msg
+}
+
+// isNotFound reports whether err means that the file does not exist,
+// rather than that it could not be fetched.
+func isNotFound(err error) bool {
+	_, notFound := errors.Cause(err).(errNotFound)
+	return notFound
+}
+
+// goproxy returns the list of module proxies to use, as defined by
+// the GOPROXY setting.
+func goproxy() []proxySpec {
+	return parseGoproxy(goEnv("GOPROXY"))
+}
+
+// goproxyOff reports whether GOPROXY=off disallows downloading modules.
+func goproxyOff() bool {
+	list := goproxy()
+	return len(list) > 0 && list[0].url == "off"
+}
+
+// parseGoproxy splits a GOPROXY value into its entries. It follows
+// the rules of the go command: An empty value means the default
+// setting, "direct" and "off" are keywords, and everything else is
+// a URL. See `go help goproxy`.
+func parseGoproxy(s string) []proxySpec {
+	if s == "" {
+		s = defaultGoproxy
+	}
+
+	var list []proxySpec
+	for s != "" {
+		u, sep := s, byte(0)
+		if i := strings.IndexAny(s, ",|"); i >= 0 {
+			u, sep, s = s[:i], s[i], s[i+1:]
+		} else {
+			s = ""
+		}
+		u = strings.TrimSpace(u)
+		if u == "" {
+			continue
+		}
+		list = append(list, proxySpec{url: strings.TrimRight(u, "/"), fallBackOnError: sep == '|'})
+	}
+	return list
+}
+
+// findProxyReadme downloads the zip file of module mod at version ver
+// from the module proxies configured in GOPROXY, and extracts the
+// README file of package pkg from it. If the package directory contains
+// no README, findProxyReadme looks into the parent directories up to
+// the module root.
+//
+// Private modules (see noProxy and noPublicProxy) are not requested
+// from proxies that must not see them.
+func findProxyReadme(pkg, mod, ver string) (readme []byte, source string, err error) {
+
+	escMod, err := module.EscapePath(mod)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "invalid module path "+mod)
+	}
+	escVer, err := module.EscapeVersion(ver)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "invalid module version "+ver)
+	}
+	file := escMod + "/@v/" + escVer + ".zip"
+
+	err = walkGoproxy("module "+mod+"@"+ver, mod, func(proxyURL string) error {
+		var err error
+		readme, source, err = readmeFromProxy(proxyURL+"/"+file, mod+"@"+ver, pkgDir(pkg, mod))
+		return err
+	})
+	return readme, source, err
+}
+
+// walkGoproxy calls fetch with the URL of each module proxy in GOPROXY in
+// turn, until fetch succeeds. Like the go command, it moves on to the next
+// proxy only after an errNotFound error, or after any error if the proxy
+// is followed by "|". name is the module or module version that fetch
+// requests, for error messages.
+//
+// If walkGoproxy reaches "direct", or if module mod must not be requested
+// from a proxy at all (see noProxy), it returns an error that wraps
+// errProxyDirect. Proxies that must not see private modules (see
+// noPublicProxy) are skipped.
+func walkGoproxy(name, mod string, fetch func(proxyURL string) error) error {
+	if noProxy(mod) {
+		return errors.Wrap(errProxyDirect, "module "+mod+" matches GONOPROXY or GOPRIVATE")
+	}
+	private := noPublicProxy(mod)
+
+	var err error
+	for _, proxy := range goproxy() {
+		switch proxy.url {
+		case "off":
+			return errProxyOff
+		case "direct":
+			if err != nil {
+				return errors.Wrapf(errProxyDirect, "%s not found in any proxy (%v)", name, err)
+			}
+			return errors.Wrap(errProxyDirect, name+" not found in any proxy")
+		}
+		if private && isPublicProxy(proxy.url) {
+			continue
+		}
+
+		if err = fetch(proxy.url); err == nil {
+			return nil
+		}
+		if !isNotFound(err) && !proxy.fallBackOnError {
+			return err
+		}
+	}
+	if err == nil {
+		return errors.Wrap(errProxyDirect, "no module proxy may serve "+name)
+	}
+	return errors.Wrap(err, name+" not found in any proxy")
+}
+
+// pkgDir returns the directory of package pkg relative to the root of module mod.
+func pkgDir(pkg, mod string) string {
+	if pkg == mod || !strings.HasPrefix(pkg, mod+"/") {
+		return ""
+	}
+	return pkg[len(mod)+1:]
+}
+
+// readmeFromProxy fetches a module zip file from a proxy URL and extracts
+// the README for directory dir. Entries in module zip files are prefixed with
+// "<module path>@<version>/".
+func readmeFromProxy(zipURL, prefix, dir string) ([]byte, string, error) {
+
+	f, err := openProxyFile(zipURL)
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() {
+		_ = f.Close()
+		if f.temp {
+			_ = os.Remove(f.Name())
+		}
+	}()
+
+	zr, err := zipReader(f.File)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "cannot read module zip file "+zipURL)
+	}
+
+	readme, name, err := readmeFromZip(zr, prefix, dir)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "no README in "+zipURL)
+	}
+	return readme, zipURL + "#" + name, nil
+}
+
+// zipReader returns a zip.Reader for the open file f.
+func zipReader(f *os.File) (*zip.Reader, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot determine size of "+f.Name())
+	}
+	return zip.NewReader(f, fi.Size())
+}
+
+// readmeFromZip finds the README file in directory dir of a module zip file.
+// If dir contains no README, readmeFromZip walks up to the module root.
+func readmeFromZip(zr *zip.Reader, prefix, dir string) ([]byte, string, error) {
+
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, zf := range zr.File {
+		files[zf.Name] = zf
+	}
+
+	for {
+		for _, name := range names {
+			zf, ok := files[path.Join(prefix, dir, name)]
+			if !ok {
+				continue
+			}
+			rc, err := zf.Open()
+			if err != nil {
+				return nil, "", errors.Wrap(err, "cannot open "+zf.Name)
+			}
+			readme, err := readReadme(rc)
+			_ = rc.Close()
+			if err != nil {
+				return nil, "", errors.Wrap(err, "cannot read "+zf.Name)
+			}
+			return readme, zf.Name, nil
+		}
+		if dir == "" {
+			break
+		}
+		dir = path.Dir(dir)
+		if dir == "." {
+			dir = ""
+		}
+	}
+	return nil, "", errNotFound{"no README file found"}
+}
+
+// proxyFile is a module zip file, either opened directly from a file:// proxy,
+// or downloaded into a temporary file.
+type proxyFile struct {
+	*os.File
+	temp bool
+}
+
+// openProxyFile opens the module zip file at a proxy URL. A zip file from
+// a file:// proxy is used in place, any other is downloaded.
+// A missing file results in an errNotFound error.
+func openProxyFile(rawURL string) (*proxyFile, error) {
+
+	rc, err := openProxyURL(context.Background(), zipClient(), rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if f, ok := rc.(*os.File); ok {
+		return &proxyFile{File: f}, nil
+	}
+	defer rc.Close()
+
+	f, err := os.CreateTemp("", "goman-*.zip")
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create temporary file")
+	}
+	n, err := io.Copy(f, io.LimitReader(rc, maxZipSize+1))
+	if err == nil && n > maxZipSize {
+		err = errors.Errorf("the module zip file is larger than %d bytes", maxZipSize)
+	}
+	if err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return nil, errors.Wrap(err, "failed downloading "+rawURL)
+	}
+	return &proxyFile{File: f, temp: true}, nil
+}
+
+// readProxyURL reads a small file, like a version list, from a module proxy.
+// A missing file results in an errNotFound error.
+func readProxyURL(ctx context.Context, rawURL string) ([]byte, error) {
+	rc, err := openProxyURL(ctx, httpClient, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, maxReadmeSize))
+	return data, errors.Wrap(err, "failed downloading "+rawURL)
+}
+
+// zipClient returns the HTTP client for downloading module zip files.
+// The timeout of httpClient includes reading the response body, which
+// is too short for a large zip file, so zipClient adds the time that
+// maxZipSize bytes take at minZipRate.
+func zipClient() *http.Client {
+	c := *httpClient
+	if c.Timeout > 0 {
+		c.Timeout += time.Duration(maxZipSize) * time.Second / time.Duration(minZipRate)
+	}
+	return &c
+}
+
+// openProxyURL opens the file at a proxy URL, which may be a file:// URL,
+// with client. For file:// URLs, the result is the *os.File, otherwise the
+// body of the HTTP response. A missing file results in an errNotFound error.
+func openProxyURL(ctx context.Context, client *http.Client, rawURL string) (io.ReadCloser, error) {
+	if strings.HasPrefix(rawURL, "file://") {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid proxy URL "+rawURL)
+		}
+		f, err := os.Open(filepath.FromSlash(u.Path))
+		if os.IsNotExist(err) {
+			return nil, errNotFound{rawURL + " does not exist"}
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot open "+rawURL)
+		}
+		return f, nil
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid proxy URL "+rawURL)
+	}
+	response, err := doWithRetry(client, request)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed downloading "+rawURL)
+	}
+
+	switch response.StatusCode {
+	case http.StatusOK:
+		return response.Body, nil
+	case http.StatusNotFound, http.StatusGone:
+		_ = response.Body.Close()
+		return nil, errNotFound{"HTTP GET returned " + response.Status + " for URL " + rawURL}
+	default:
+		_ = response.Body.Close()
+		return nil, errors.New("HTTP GET returned " + response.Status + " for URL " + rawURL)
+	}
+}
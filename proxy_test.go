@@ -0,0 +1,209 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func Test_parseGoproxy(t *testing.T) {
+	tests := []struct {
+		name string
+		env  string
+		want []proxySpec
+	}{
+		{"default", "", []proxySpec{{"https://proxy.golang.org", false}, {"direct", false}}},
+		{"off", "off", []proxySpec{{"off", false}}},
+		{"comma", "https://a.example.com/,https://b.example.com", []proxySpec{{"https://a.example.com", false}, {"https://b.example.com", false}}},
+		{"pipe", "https://a.example.com|file:///tmp/proxy,direct", []proxySpec{{"https://a.example.com", true}, {"file:///tmp/proxy", false}, {"direct", false}}},
+		{"empty entries", ",https://a.example.com,,off", []proxySpec{{"https://a.example.com", false}, {"off", false}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseGoproxy(tt.env); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseGoproxy(%q) = %v, want %v", tt.env, got, tt.want)
+			}
+		})
+	}
+}
+
+// moduleZip creates a module zip file with the given files, relative to the module root.
+func moduleZip(t *testing.T, prefix string, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(prefix + "/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func Test_findProxyReadme(t *testing.T) {
+	zipFile := moduleZip(t, "github.com/User/repo/v2@v2.1.0", map[string]string{
+		"README.md":            "root readme",
+		"cmd/tool/README":      "tool readme",
+		"cmd/other/main.go":    "package main",
+		"internal/x/README.md": "internal readme",
+	})
+	zipPath := "/github.com/!user/repo/v2/@v/v2.1.0.zip"
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case zipPath:
+			_, _ = w.Write(zipFile)
+		case "/broken" + zipPath:
+			http.Error(w, "boom", http.StatusInternalServerError)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	fp := filepath.Join(dir, filepath.FromSlash(zipPath))
+	if err := os.MkdirAll(filepath.Dir(fp), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fp, zipFile, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fileProxy := "file://" + filepath.ToSlash(dir)
+
+	tests := []struct {
+		name    string
+		goproxy string
+		pkg     string
+		want    string
+		wantErr bool
+	}{
+		{"pkg readme", srv.URL, "github.com/User/repo/v2/cmd/tool", "tool readme", false},
+		{"walk up", srv.URL, "github.com/User/repo/v2/cmd/other", "root readme", false},
+		{"module root", srv.URL, "github.com/User/repo/v2", "root readme", false},
+		{"file proxy", fileProxy, "github.com/User/repo/v2/cmd/tool", "tool readme", false},
+		{"not found falls through", srv.URL + "/missing," + srv.URL, "github.com/User/repo/v2", "root readme", false},
+		{"error stops comma list", srv.URL + "/broken," + srv.URL, "github.com/User/repo/v2", "", true},
+		{"error falls through pipe", srv.URL + "/broken|" + srv.URL, "github.com/User/repo/v2", "root readme", false},
+		{"direct", "direct," + srv.URL, "github.com/User/repo/v2", "", true},
+		{"off", "off", "github.com/User/repo/v2", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GOPROXY", tt.goproxy)
+			readme, source, err := findProxyReadme(tt.pkg, "github.com/User/repo/v2", "v2.1.0")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("findProxyReadme() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if string(readme) != tt.want {
+				t.Errorf("findProxyReadme() = %q, want %q", readme, tt.want)
+			}
+			if err == nil && !strings.Contains(source, "github.com/User/repo/v2@v2.1.0/") {
+				t.Errorf("findProxyReadme() source = %s", source)
+			}
+		})
+	}
+}
+
+func Test_openProxyFile_limit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(bytes.Repeat([]byte("x"), 2048))
+	}))
+	defer srv.Close()
+
+	defer func(n int64) { maxZipSize = n }(maxZipSize)
+	maxZipSize = 1024
+	if f, err := openProxyFile(srv.URL + "/mod.zip"); err == nil || !strings.Contains(err.Error(), "larger than 1024 bytes") {
+		t.Errorf("openProxyFile() = %v, %v, want a size error", f, err)
+	}
+
+	maxZipSize = 2048
+	f, err := openProxyFile(srv.URL + "/mod.zip")
+	if err != nil {
+		t.Fatalf("openProxyFile() error = %v", err)
+	}
+	_ = f.Close()
+	_ = os.Remove(f.Name())
+}
+
+func Test_openProxyFile_slow(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(bytes.Repeat([]byte("x"), 1024))
+		w.(http.Flusher).Flush()
+		time.Sleep(200 * time.Millisecond)
+		_, _ = w.Write(bytes.Repeat([]byte("x"), 1024))
+	}))
+	defer srv.Close()
+
+	// The download takes longer than a request may take, but
+	// it is fast enough for the size of the zip file.
+	defer func(d time.Duration, n, r int64) { httpClient.Timeout, maxZipSize, minZipRate = d, n, r }(httpClient.Timeout, maxZipSize, minZipRate)
+	httpClient.Timeout, maxZipSize, minZipRate = 100*time.Millisecond, 4096, 4096
+	f, err := openProxyFile(srv.URL + "/mod.zip")
+	if err != nil {
+		t.Fatalf("openProxyFile() error = %v", err)
+	}
+	_ = f.Close()
+	_ = os.Remove(f.Name())
+}
+
+func Test_walkGoproxy(t *testing.T) {
+	t.Setenv("GOPRIVATE", "corp.example.com")
+	t.Setenv("GONOPROXY", "")
+	t.Setenv("GONOSUMDB", "")
+	errMissing := errNotFound{"404 Not Found"}
+	errBroken := errors.New("500 Internal Server Error")
+	responses := map[string]error{
+		"https://missing.example.com": errMissing,
+		"https://broken.example.com":  errBroken,
+		"https://good.example.com":    nil,
+	}
+	tests := []struct {
+		name    string
+		goproxy string
+		mod     string
+		want    []string
+		wantErr error
+	}{
+		{"first proxy", "https://good.example.com,direct", "example.com/mod", []string{"https://good.example.com"}, nil},
+		{"not found, next proxy", "https://missing.example.com,https://good.example.com", "example.com/mod", []string{"https://missing.example.com", "https://good.example.com"}, nil},
+		{"not found, direct", "https://missing.example.com,direct", "example.com/mod", []string{"https://missing.example.com"}, errProxyDirect},
+		{"not found, no direct", "https://missing.example.com", "example.com/mod", []string{"https://missing.example.com"}, errMissing},
+		{"error stops", "https://broken.example.com,direct", "example.com/mod", []string{"https://broken.example.com"}, errBroken},
+		{"error, pipe", "https://broken.example.com|direct", "example.com/mod", []string{"https://broken.example.com"}, errProxyDirect},
+		{"off", "https://missing.example.com,off", "example.com/mod", []string{"https://missing.example.com"}, errProxyOff},
+		{"private module", "https://proxy.golang.org,direct", "corp.example.com/mod", nil, errProxyDirect},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GOPROXY", tt.goproxy)
+			var got []string
+			err := walkGoproxy("module "+tt.mod, tt.mod, func(proxyURL string) error {
+				got = append(got, proxyURL)
+				return responses[proxyURL]
+			})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("walkGoproxy() requested %v, want %v", got, tt.want)
+			}
+			if (err == nil) != (tt.wantErr == nil) || !errors.Is(err, tt.wantErr) {
+				t.Errorf("walkGoproxy() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
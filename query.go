@@ -0,0 +1,238 @@
+// (C) 2017 Christoph Berger <mail@christophberger.com>. Some rights reserved.
+// Distributed under a 3-clause BSD license; see LICENSE.txt.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// goman accepts module and package paths with a version query in place of
+// a binary, like `go install` does: golang.org/x/tools/cmd/stringer@v0.20.0,
+// github.com/user/repo@latest, or example.com/mod@<v2.0.0.
+// See "Version queries" in the Go Modules Reference.
+
+// isImportPath reports whether arg looks like a package path rather than the
+// name or path of a binary: it has a domain name as its first element, and
+// at least one more element.
+func isImportPath(arg string) bool {
+	first, _, ok := strings.Cut(arg, "/")
+	return ok && strings.Contains(first, ".") && module.CheckImportPath(arg) == nil
+}
+
+// resolveQuery returns the source of package pkg at version query. query may
+// be empty, which means "latest". Like the go command, resolveQuery asks the
+// module proxies for each prefix of pkg, and the longest prefix for which the
+// query resolves is the module.
+//
+// Modules that must not be fetched from a proxy (see noProxy), or that no
+// proxy knows when GOPROXY falls back to "direct", cannot be resolved.
+// For these, the version is passed on as a tag or revision if it
+// is one, and otherwise, the README of the default branch will do.
+func resolveQuery(pkg, query string) (binInfo, error) {
+	if query == "" {
+		query = "latest"
+	}
+	if err := module.CheckImportPath(pkg); err != nil {
+		return binInfo{}, errors.Wrap(err, "invalid package path")
+	}
+
+	var mods []string
+	for p := pkg; p != "."; p = path.Dir(p) {
+		mods = append(mods, p)
+	}
+	versions := make([]string, len(mods))
+	errs := make([]error, len(mods))
+	i, _, err := firstSuccess(context.Background(), len(mods), maxParallelRequests,
+		func(ctx context.Context, i int) ([]byte, error) {
+			versions[i], errs[i] = queryModule(ctx, mods[i], query)
+			return nil, errs[i]
+		})
+	if err == nil {
+		return binInfo{Path: pkg, Module: mods[i], Version: versions[i]}, nil
+	}
+
+	if errors.Is(err, errProxyDirect) {
+		if *verbose {
+			log.Println(errors.Wrap(err, "cannot resolve "+pkg+"@"+query))
+		}
+		bi := binInfo{Path: pkg}
+		switch {
+		case isExactVersion(query):
+			bi.Version = query
+		case !isVersionRange(query):
+			bi.Revision = query
+		}
+		return bi, nil
+	}
+
+	// "Not found" for the longer prefixes is expected; report the
+	// error of the module that exists, if any.
+	for _, e := range errs {
+		if _, notFound := errors.Cause(e).(errNotFound); e != nil && !notFound {
+			err = e
+			break
+		}
+	}
+	return binInfo{}, errors.Wrapf(err, "cannot resolve %s@%s", pkg, query)
+}
+
+// isVersionRange reports whether query stands for a range of versions
+// rather than for a single tag, branch, or commit.
+func isVersionRange(query string) bool {
+	switch query {
+	case "latest", "upgrade", "patch":
+		return true
+	}
+	return strings.HasPrefix(query, "<") || strings.HasPrefix(query, ">") ||
+		semver.IsValid(query) && !isExactVersion(query)
+}
+
+// isExactVersion reports whether query is a complete semantic version,
+// as opposed to a prefix like v1 or v1.2.
+func isExactVersion(query string) bool {
+	return semver.IsValid(query) && semver.Canonical(query) == strings.TrimSuffix(query, "+incompatible")
+}
+
+// queryModule resolves the version query for module mod. Without an
+// installed version to compare to, "upgrade" and "patch" mean "latest".
+// In offline mode, only the versions in the module cache are known.
+func queryModule(ctx context.Context, mod, query string) (string, error) {
+	if *offline {
+		versions := cachedVersions(mod)
+		if len(versions) == 0 {
+			return "", errNotFound{"module " + mod + " is not in the module cache"}
+		}
+		if v, ok := matchVersion(versions, query); ok {
+			return v, nil
+		}
+		return "", errors.Errorf("no version of %s in the module cache matches %s", mod, query)
+	}
+
+	if !isVersionRange(query) {
+		// An exact version, or a branch or commit, which the proxy
+		// translates into a pseudo-version.
+		escQuery, err := module.EscapeVersion(query)
+		if err != nil {
+			return "", errors.Wrap(err, "invalid version query "+query)
+		}
+		return proxyInfo(ctx, mod, "@v/"+escQuery+".info")
+	}
+
+	list, err := proxyGet(ctx, mod, "@v/list")
+	if err != nil {
+		return "", err
+	}
+	if v, ok := matchVersion(strings.Fields(string(list)), query); ok {
+		return v, nil
+	}
+	if query == "latest" || query == "upgrade" || query == "patch" {
+		// Modules without tags have pseudo-versions only.
+		return proxyInfo(ctx, mod, "@latest")
+	}
+	return "", errors.Errorf("no version of %s matches %s", mod, query)
+}
+
+// matchVersion returns the version from versions that query selects:
+//
+//   - latest, upgrade, patch: the highest version,
+//   - v1 or v1.2 (a prefix): the highest version with this prefix,
+//   - <v1.2.3 or <=v1.2.3: the highest version below or at v1.2.3,
+//   - >v1.2.3 or >=v1.2.3: the lowest version above or at v1.2.3,
+//   - v1.2.3: exactly this version.
+//
+// Releases win over pre-releases, which win over pseudo-versions.
+func matchVersion(versions []string, query string) (string, bool) {
+	match := func(v string) bool { return v == query }
+	lowest := false
+	switch {
+	case query == "latest" || query == "upgrade" || query == "patch":
+		match = func(string) bool { return true }
+	case strings.HasPrefix(query, "<") || strings.HasPrefix(query, ">"):
+		op, target := query[:1], query[1:]
+		if strings.HasPrefix(target, "=") {
+			op, target = query[:2], query[2:]
+		}
+		if !semver.IsValid(target) {
+			return "", false
+		}
+		lowest = op[0] == '>'
+		match = func(v string) bool {
+			switch c := semver.Compare(v, target); op {
+			case "<":
+				return c < 0
+			case "<=":
+				return c <= 0
+			case ">":
+				return c > 0
+			default:
+				return c >= 0
+			}
+		}
+	case semver.IsValid(query) && !isExactVersion(query):
+		match = func(v string) bool { return strings.HasPrefix(v, query+".") }
+	}
+
+	best, bestRank := "", -1
+	for _, v := range versions {
+		if !semver.IsValid(v) || !match(v) {
+			continue
+		}
+		rank := 2
+		switch {
+		case module.IsPseudoVersion(v):
+			rank = 0
+		case semver.Prerelease(v) != "":
+			rank = 1
+		}
+		better := semver.Compare(v, best) > 0
+		if lowest {
+			better = semver.Compare(v, best) < 0
+		}
+		if rank > bestRank || rank == bestRank && better {
+			best, bestRank = v, rank
+		}
+	}
+	return best, best != ""
+}
+
+// proxyInfo requests a version info file, like @latest or @v/<version>.info,
+// for module mod from the module proxies, and returns the version in it.
+func proxyInfo(ctx context.Context, mod, file string) (string, error) {
+	data, err := proxyGet(ctx, mod, file)
+	if err != nil {
+		return "", err
+	}
+	var info struct {
+		Version string
+	}
+	if err := json.Unmarshal(data, &info); err != nil || !semver.IsValid(info.Version) {
+		return "", errors.Errorf("invalid version info for %s from the module proxy", mod)
+	}
+	return info.Version, nil
+}
+
+// proxyGet requests file (a path below the escaped module path) for module
+// mod from the module proxies configured in GOPROXY, with the same rules for
+// falling back to the next proxy and for private modules as findProxyReadme.
+func proxyGet(ctx context.Context, mod, file string) ([]byte, error) {
+	escMod, err := module.EscapePath(mod)
+	if err != nil {
+		return nil, errNotFound{"invalid module path " + mod}
+	}
+	var data []byte
+	err = walkGoproxy("module "+mod, mod, func(proxyURL string) error {
+		var err error
+		data, err = readProxyURL(ctx, proxyURL+"/"+escMod+"/"+file)
+		return err
+	})
+	return data, err
+}
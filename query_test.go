@@ -0,0 +1,168 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_isImportPath(t *testing.T) {
+	tests := []struct {
+		arg  string
+		want bool
+	}{
+		{"golang.org/x/tools/cmd/stringer", true},
+		{"github.com/user/repo", true},
+		{"stringer", false},
+		{"golang.org", false},
+		{"bin/tool", false},
+		{"./tool", false},
+		{"/usr/local/bin/tool", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			if got := isImportPath(tt.arg); got != tt.want {
+				t.Errorf("isImportPath(%q) = %v, want %v", tt.arg, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_matchVersion(t *testing.T) {
+	versions := []string{"v1.0.0", "v1.1.0", "v1.1.1", "v1.2.0-rc.1", "v2.0.0+incompatible", "v0.0.0-20240101000000-0123456789ab"}
+	tests := []struct {
+		name   string
+		query  string
+		want   string
+		wantOK bool
+	}{
+		{"latest", "latest", "v2.0.0+incompatible", true},
+		{"upgrade", "upgrade", "v2.0.0+incompatible", true},
+		{"major prefix", "v1", "v1.1.1", true},
+		{"minor prefix", "v1.1", "v1.1.1", true},
+		{"less than", "<v1.1.1", "v1.1.0", true},
+		{"less or equal", "<=v1.1.1", "v1.1.1", true},
+		{"greater than", ">v1.0.0", "v1.1.0", true},
+		{"greater or equal", ">=v1.0.0", "v1.0.0", true},
+		{"pre-release only if no release matches", ">v1.1.1", "v2.0.0+incompatible", true},
+		{"exact", "v1.1.0", "v1.1.0", true},
+		{"no match", "v3", "", false},
+		{"invalid range", "<main", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := matchVersion(versions, tt.query)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("matchVersion(%q) = %q, %v, want %q, %v", tt.query, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+
+	if got, _ := matchVersion([]string{"v0.0.0-20240101000000-0123456789ab", "v1.0.0-beta"}, "latest"); got != "v1.0.0-beta" {
+		t.Errorf("matchVersion() = %q, want the pre-release over the pseudo-version", got)
+	}
+}
+
+func Test_resolveQuery(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"example.com/mod/@v/list":               "v1.0.0\nv1.1.0\nv1.2.0-rc.1\n",
+		"example.com/mod/@v/v1.0.0.info":        `{"Version":"v1.0.0"}`,
+		"example.com/mod/@v/main.info":          `{"Version":"v1.1.1-0.20240101000000-0123456789ab"}`,
+		"example.com/untagged/@v/list":          "",
+		"example.com/untagged/@latest":          `{"Version":"v0.0.0-20240101000000-0123456789ab"}`,
+		"example.com/!upper/@v/list":            "v0.1.0\n",
+		"example.com/mod/nested/@v/list":        "v0.3.0\n",
+		"example.com/mod/nested/@v/v0.3.0.info": `{"Version":"v0.3.0"}`,
+	}
+	for name, content := range files {
+		fp := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fp), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fp, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("GOPROXY", "file://"+filepath.ToSlash(dir))
+	t.Setenv("GOPRIVATE", "private.example.com")
+	t.Setenv("GONOPROXY", "")
+
+	defer func(v, o *bool) { verbose, offline = v, o }(verbose, offline)
+	verbose, offline = new(bool), new(bool)
+
+	tests := []struct {
+		name    string
+		pkg     string
+		query   string
+		want    binInfo
+		wantErr bool
+	}{
+		{"latest", "example.com/mod", "latest", binInfo{Path: "example.com/mod", Module: "example.com/mod", Version: "v1.1.0"}, false},
+		{"empty query", "example.com/mod/cmd/tool", "", binInfo{Path: "example.com/mod/cmd/tool", Module: "example.com/mod", Version: "v1.1.0"}, false},
+		{"range", "example.com/mod/cmd/tool", "<v1.1.0", binInfo{Path: "example.com/mod/cmd/tool", Module: "example.com/mod", Version: "v1.0.0"}, false},
+		{"exact", "example.com/mod", "v1.0.0", binInfo{Path: "example.com/mod", Module: "example.com/mod", Version: "v1.0.0"}, false},
+		{"branch", "example.com/mod", "main", binInfo{Path: "example.com/mod", Module: "example.com/mod", Version: "v1.1.1-0.20240101000000-0123456789ab"}, false},
+		{"nested module", "example.com/mod/nested/cmd", "latest", binInfo{Path: "example.com/mod/nested/cmd", Module: "example.com/mod/nested", Version: "v0.3.0"}, false},
+		{"pseudo-versions only", "example.com/untagged", "upgrade", binInfo{Path: "example.com/untagged", Module: "example.com/untagged", Version: "v0.0.0-20240101000000-0123456789ab"}, false},
+		{"escaped path", "example.com/Upper", "v0", binInfo{Path: "example.com/Upper", Module: "example.com/Upper", Version: "v0.1.0"}, false},
+		{"private tag", "private.example.com/repo/cmd", "v1.2.3", binInfo{Path: "private.example.com/repo/cmd", Version: "v1.2.3"}, false},
+		{"private branch", "private.example.com/repo", "dev", binInfo{Path: "private.example.com/repo", Revision: "dev"}, false},
+		{"private latest", "private.example.com/repo", "latest", binInfo{Path: "private.example.com/repo"}, false},
+		{"no matching version", "example.com/mod", "v2", binInfo{}, true},
+		{"unknown module", "example.com/missing", "latest", binInfo{}, true},
+		{"invalid path", "example.com/a b", "latest", binInfo{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveQuery(tt.pkg, tt.query)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveQuery() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("resolveQuery() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_resolveQuery_direct(t *testing.T) {
+	// The proxy does not know the module, so GOPROXY sends goman to the repository.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "not found: unknown revision", http.StatusGone)
+	}))
+	defer srv.Close()
+	t.Setenv("GOPRIVATE", "")
+	t.Setenv("GONOPROXY", "")
+	t.Setenv("GONOSUMDB", "")
+
+	defer func(v, o *bool) { verbose, offline = v, o }(verbose, offline)
+	verbose, offline = new(bool), new(bool)
+
+	tests := []struct {
+		name    string
+		goproxy string
+		query   string
+		want    binInfo
+		wantErr bool
+	}{
+		{"tag", srv.URL + ",direct", "v1.2.3", binInfo{Path: "example.com/repo/cmd/tool", Version: "v1.2.3"}, false},
+		{"branch", srv.URL + ",direct", "dev", binInfo{Path: "example.com/repo/cmd/tool", Revision: "dev"}, false},
+		{"latest", srv.URL + ",direct", "latest", binInfo{Path: "example.com/repo/cmd/tool"}, false},
+		{"no direct", srv.URL, "v1.2.3", binInfo{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GOPROXY", tt.goproxy)
+			got, err := resolveQuery("example.com/repo/cmd/tool", tt.query)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveQuery() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("resolveQuery() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
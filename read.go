@@ -0,0 +1,117 @@
+// (C) 2017 Christoph Berger <mail@christophberger.com>. Some rights reserved.
+// Distributed under a 3-clause BSD license; see LICENSE.txt.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// maxReadmeSize is the maximum size of a README file in bytes.
+// Longer README files are truncated.
+var maxReadmeSize int64 = 1 << 20
+
+// readReadme reads a README file from r, which may be gzip-compressed.
+// It reads no more than maxReadmeSize bytes, and appends a notice to
+// README files that are longer.
+func readReadme(r io.Reader) ([]byte, error) {
+	readme, truncated, err := readLimited(r)
+	if err != nil {
+		return nil, err
+	}
+	if truncated {
+		readme = appendTruncationNotice(readme)
+	}
+	return readme, nil
+}
+
+// readFileReadme reads the README file at path fp like readReadme does.
+func readFileReadme(fp string) ([]byte, error) {
+	f, err := os.Open(fp)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	readme, err := readReadme(f)
+	return readme, errors.Wrap(err, "cannot read "+fp)
+}
+
+// readLimited reads at most maxReadmeSize bytes from r and reports whether
+// there would have been more. Data with a gzip header is decompressed, and
+// the limit applies to the decompressed data. A truncated README ends at a
+// line break if possible, and never within a UTF-8 sequence.
+func readLimited(r io.Reader) (readme []byte, truncated bool, err error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, false, errors.Wrap(err, "invalid gzip data")
+		}
+		defer zr.Close()
+		r = zr
+	} else {
+		r = br
+	}
+
+	readme, err = io.ReadAll(io.LimitReader(r, maxReadmeSize+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if int64(len(readme)) <= maxReadmeSize {
+		return readme, false, nil
+	}
+
+	readme = readme[:maxReadmeSize]
+	if i := bytes.LastIndexByte(readme, '\n'); i > 0 {
+		return readme[:i+1], true, nil
+	}
+	for i := 1; i < utf8.UTFMax && len(readme) > 0; i++ {
+		if r, _ := utf8.DecodeLastRune(readme); r != utf8.RuneError {
+			break
+		}
+		readme = readme[:len(readme)-1]
+	}
+	return readme, true, nil
+}
+
+// appendTruncationNotice appends a note to a truncated README.
+func appendTruncationNotice(readme []byte) []byte {
+	return append(readme, fmt.Sprintf("\n\n---\n\n*goman: The README is longer than %d bytes and was truncated. The limit can be raised with max_size in the configuration file.*\n", maxReadmeSize)...)
+}
+
+// deflateReader decompresses an HTTP response body with
+// "Content-Encoding: deflate". According to RFC 9110, this is the
+// zlib format, but some servers send raw deflate data.
+func deflateReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	if h, err := br.Peek(2); err == nil && h[0]&0x0f == 8 && (uint16(h[0])<<8|uint16(h[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
+
+// base64Reader decodes an HTTP response body that is base64-encoded, as
+// Gitiles sends files. Compression applies to the encoded data, so a gzip
+// stream is decompressed first.
+func base64Reader(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid gzip data")
+		}
+		return base64.NewDecoder(base64.StdEncoding, zr), nil
+	}
+	return base64.NewDecoder(base64.StdEncoding, br), nil
+}
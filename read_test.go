@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func compress(t *testing.T, newWriter func(io.Writer) io.WriteCloser, data string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := newWriter(&buf)
+	if _, err := w.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func gzipWriter(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }
+func zlibWriter(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) }
+func flateWriter(w io.Writer) io.WriteCloser {
+	fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+	return fw
+}
+
+func Test_readLimited(t *testing.T) {
+	defer func(m int64) { maxReadmeSize = m }(maxReadmeSize)
+	maxReadmeSize = 16
+
+	tests := []struct {
+		name          string
+		data          []byte
+		want          string
+		wantTruncated bool
+	}{
+		{"short", []byte("# Title\n"), "# Title\n", false},
+		{"exactly the limit", []byte("0123456789abcdef"), "0123456789abcdef", false},
+		{"cut at line break", []byte("# Title\nline two is long\n"), "# Title\n", true},
+		{"cut before UTF-8 sequence", []byte("0123456789abcd€€"), "0123456789abcd", true},
+		{"gzip", compress(t, gzipWriter, "# Title\n"), "# Title\n", false},
+		{"gzip bomb", compress(t, gzipWriter, strings.Repeat("x", 1<<20)), strings.Repeat("x", 16), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, truncated, err := readLimited(bytes.NewReader(tt.data))
+			if err != nil {
+				t.Fatalf("readLimited() error = %v", err)
+			}
+			if string(got) != tt.want || truncated != tt.wantTruncated {
+				t.Errorf("readLimited() = %q, %v, want %q, %v", got, truncated, tt.want, tt.wantTruncated)
+			}
+		})
+	}
+}
+
+func Test_readFileReadme(t *testing.T) {
+	defer func(m int64) { maxReadmeSize = m }(maxReadmeSize)
+	maxReadmeSize = 16
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"README.md": "# Title\n" + strings.Repeat("text ", 1000)})
+	got, err := readFileReadme(dir + "/README.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(got, []byte("# Title\n")) || !bytes.Contains(got, []byte("truncated")) {
+		t.Errorf("readFileReadme() = %q, want the first line and a truncation notice", got)
+	}
+}
+
+func Test_httpGetReadme_encoding(t *testing.T) {
+	const readme = "# Title\n\nSome text.\n"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		switch r.URL.Path {
+		case "/gzip":
+			w.Header().Set("Content-Encoding", "gzip")
+			_, _ = w.Write(compress(t, gzipWriter, readme))
+		case "/deflate":
+			w.Header().Set("Content-Encoding", "deflate")
+			_, _ = w.Write(compress(t, zlibWriter, readme))
+		case "/rawdeflate":
+			w.Header().Set("Content-Encoding", "deflate")
+			_, _ = w.Write(compress(t, flateWriter, readme))
+		case "/huge":
+			_, _ = w.Write([]byte(readme + strings.Repeat("more text\n", 1000)))
+		case "/gitiles":
+			w.Header().Set("X-FYI-Content-Encoding", "base64")
+			_, _ = w.Write([]byte(base64.StdEncoding.EncodeToString([]byte(readme))))
+		case "/gitilesgzip":
+			w.Header().Set("X-FYI-Content-Encoding", "base64")
+			w.Header().Set("Content-Encoding", "gzip")
+			_, _ = w.Write(compress(t, gzipWriter, base64.StdEncoding.EncodeToString([]byte(readme))))
+		}
+	}))
+	defer srv.Close()
+
+	defer func(m int64) { maxReadmeSize = m }(maxReadmeSize)
+	maxReadmeSize = int64(len(readme))
+
+	for _, path := range []string{"/gzip", "/deflate", "/rawdeflate", "/huge", "/gitiles", "/gitilesgzip"} {
+		t.Run(path, func(t *testing.T) {
+			got, err := httpGetReadme(context.Background(), srv.URL+path, nil)
+			if err != nil {
+				t.Fatalf("httpGetReadme() error = %v", err)
+			}
+			if !bytes.HasPrefix(got.Content, []byte(readme)) {
+				t.Errorf("httpGetReadme() = %q, want %q", got.Content, readme)
+			}
+			if truncated := bytes.Contains(got.Content, []byte("truncated")); truncated != (path == "/huge") {
+				t.Errorf("httpGetReadme() = %q, truncation notice: %v", got.Content, truncated)
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+// (C) 2017 Christoph Berger <mail@christophberger.com>. Some rights reserved.
+// Distributed under a 3-clause BSD license; see LICENSE.txt.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// maxRetries is the number of times a request is repeated after a
+	// transient error or after the server has rate-limited the client.
+	maxRetries = 3
+	// maxRetryWait is the longest time to wait before a retry. If the server
+	// asks to wait longer (with Retry-After or X-RateLimit-Reset), the
+	// request fails.
+	maxRetryWait = 10 * time.Second
+	// retryBaseDelay is the delay before the first retry. The delay doubles
+	// with each retry, and a random jitter is applied.
+	retryBaseDelay = 500 * time.Millisecond
+)
+
+// rateLimitError means that a host rejected requests because of its rate limit.
+type rateLimitError struct {
+	host  string
+	reset time.Time // when the limit resets; zero if unknown
+}
+
+func (e *rateLimitError) Error() string {
+	msg := "rate limited by " + e.host
+	if !e.reset.IsZero() {
+		msg += " until " + e.reset.Format(time.Kitchen)
+	}
+	return msg
+}
+
+// hint tells the user how to get around the rate limit.
+func (e *rateLimitError) hint() string {
+	if envs := tokenEnvs[e.host]; len(envs) > 0 {
+		return fmt.Sprintf("%s, set an access token in %s to raise the limit.", e, envs[0])
+	}
+	return fmt.Sprintf("%s, set an access token for %s (see token_env in the configuration file) to raise the limit.", e, e.host)
+}
+
+// doWithRetry sends a request with client. It repeats the request after
+// transient errors and when the server rate-limits the client, with
+// exponential backoff and jitter, or after the time that the server asks for.
+// If the rate limit persists, the error is a *rateLimitError.
+func doWithRetry(client *http.Client, request *http.Request) (*http.Response, error) {
+	ctx := request.Context()
+	for attempt := 0; ; attempt++ {
+		response, err := client.Do(request)
+		if err != nil && !transientError(err) || err == nil && !transientStatus(response) {
+			return response, err
+		}
+
+		wait := backoff(attempt)
+		var limited *rateLimitError
+		if err == nil {
+			if d, ok := serverWait(response, time.Now()); ok {
+				wait = d
+			}
+			if rateLimited(response) {
+				limited = &rateLimitError{host: request.URL.Hostname(), reset: resetTime(response, time.Now())}
+			}
+		}
+
+		if attempt >= maxRetries || wait > maxRetryWait {
+			if limited != nil {
+				_ = response.Body.Close()
+				return nil, limited
+			}
+			return response, err
+		}
+		if response != nil {
+			_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 4096))
+			_ = response.Body.Close()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, errors.Wrap(ctx.Err(), "request canceled while waiting for retry")
+		case <-timer.C:
+		}
+	}
+}
+
+// hostLimits stops a group of concurrent requests, like the candidates of
+// firstSuccess, from hammering a host that has rate-limited one of them:
+// it cancels the running requests to that host, and fails the requests
+// that start afterwards without sending them. The zero value is ready to use.
+type hostLimits struct {
+	mu      sync.Mutex
+	limited map[string]*rateLimitError
+	cancels map[string][]context.CancelFunc
+	first   *rateLimitError
+}
+
+// do calls fetch for a request to host, unless host has rate-limited
+// an earlier request of the group.
+func (h *hostLimits) do(ctx context.Context, host string, fetch func(ctx context.Context) error) error {
+	h.mu.Lock()
+	if rl := h.limited[host]; rl != nil {
+		h.mu.Unlock()
+		return rl
+	}
+	if h.cancels == nil {
+		h.limited = map[string]*rateLimitError{}
+		h.cancels = map[string][]context.CancelFunc{}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	h.cancels[host] = append(h.cancels[host], cancel)
+	h.mu.Unlock()
+
+	err := fetch(ctx)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var rl *rateLimitError
+	if errors.As(err, &rl) && h.limited[host] == nil {
+		h.limited[host] = rl
+		if h.first == nil {
+			h.first = rl
+		}
+		for _, c := range h.cancels[host] {
+			c()
+		}
+		return err
+	}
+	if err != nil && h.limited[host] != nil {
+		// canceled because of the rate limit
+		return h.limited[host]
+	}
+	return err
+}
+
+// err returns the first rate limit error of the group, or nil.
+func (h *hostLimits) err() *rateLimitError {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.first
+}
+
+// urlHost returns the host of rawURL, or rawURL itself if it cannot be parsed.
+func urlHost(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return rawURL
+}
+
+// backoff returns the delay before retry number attempt+1:
+// a random duration between half and all of retryBaseDelay * 2^attempt.
+func backoff(attempt int) time.Duration {
+	d := retryBaseDelay << min(attempt, 10)
+	return d/2 + rand.N(d/2+1)
+}
+
+// transientError reports whether a failed request may succeed when repeated:
+// the connection was reset or closed early, or the network reports
+// a temporary error. Everything else, like timeouts, unknown hosts, refused
+// connections, certificate errors, or unsupported URL schemes, would fail
+// again, and a retry would only make goman slower.
+func transientError(err error) bool {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, errOffline), errors.As(err, &dnsErr):
+		return false
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.ECONNABORTED), errors.Is(err, syscall.EPIPE),
+		errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return true
+	case errors.As(err, &netErr):
+		return !netErr.Timeout() && netErr.Temporary()
+	}
+	return false
+}
+
+// transientStatus reports whether the response status may change
+// when the request is repeated.
+func transientStatus(response *http.Response) bool {
+	switch response.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return rateLimited(response)
+}
+
+// rateLimited reports whether the response rejects the request because of a
+// rate limit. GitHub responds with "403 Forbidden" and X-RateLimit-Remaining: 0,
+// or with a Retry-After header for secondary rate limits.
+func rateLimited(response *http.Response) bool {
+	switch response.StatusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusForbidden:
+		return response.Header.Get("X-RateLimit-Remaining") == "0" || response.Header.Get("Retry-After") != ""
+	}
+	return false
+}
+
+// serverWait returns the time to wait before the next request, if the server
+// says so in a Retry-After header (seconds or HTTP date), or, when the rate
+// limit is exhausted, in an X-RateLimit-Reset or RateLimit-Reset header.
+func serverWait(response *http.Response, now time.Time) (time.Duration, bool) {
+	if ra := strings.TrimSpace(response.Header.Get("Retry-After")); ra != "" {
+		if secs, err := strconv.Atoi(ra); err == nil {
+			return max(time.Duration(secs)*time.Second, 0), true
+		}
+		if t, err := http.ParseTime(ra); err == nil {
+			return max(t.Sub(now), 0), true
+		}
+	}
+	if rateLimited(response) {
+		if reset := resetTime(response, now); !reset.IsZero() {
+			return max(reset.Sub(now), 0), true
+		}
+	}
+	return 0, false
+}
+
+// resetTime returns the time when the rate limit resets, or the zero time
+// if the response does not tell. X-RateLimit-Reset (GitHub) and
+// RateLimit-Reset (GitLab) contain a Unix time; RateLimit-Reset may also
+// contain the number of seconds until the reset.
+func resetTime(response *http.Response, now time.Time) time.Time {
+	for _, h := range []string{"X-RateLimit-Reset", "RateLimit-Reset"} {
+		v, err := strconv.ParseInt(strings.TrimSpace(response.Header.Get(h)), 10, 64)
+		if err != nil || v < 0 {
+			continue
+		}
+		if v > 1e9 {
+			return time.Unix(v, 0)
+		}
+		return now.Add(time.Duration(v) * time.Second)
+	}
+	if ra := response.Header.Get("Retry-After"); ra != "" {
+		if secs, err := strconv.Atoi(strings.TrimSpace(ra)); err == nil {
+			return now.Add(time.Duration(secs) * time.Second)
+		}
+	}
+	return time.Time{}
+}
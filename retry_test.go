@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func Test_serverWait(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		status   int
+		header   map[string]string
+		want     time.Duration
+		wantOK   bool
+		wantRate bool
+	}{
+		{"retry-after seconds", 503, map[string]string{"Retry-After": "7"}, 7 * time.Second, true, false},
+		{"retry-after date", 429, map[string]string{"Retry-After": "Wed, 01 May 2024 12:01:00 GMT"}, time.Minute, true, true},
+		{"github reset", 403, map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": strconv.FormatInt(now.Add(90*time.Second).Unix(), 10)}, 90 * time.Second, true, true},
+		{"gitlab reset", 429, map[string]string{"RateLimit-Reset": strconv.FormatInt(now.Add(time.Minute).Unix(), 10)}, time.Minute, true, true},
+		{"reset in the past", 429, map[string]string{"RateLimit-Reset": strconv.FormatInt(now.Add(-time.Minute).Unix(), 10)}, 0, true, true},
+		{"forbidden", 403, map[string]string{"X-RateLimit-Remaining": "12", "X-RateLimit-Reset": "1714564800"}, 0, false, false},
+		{"no hints", 502, nil, 0, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := &http.Response{StatusCode: tt.status, Header: http.Header{}}
+			for k, v := range tt.header {
+				response.Header.Set(k, v)
+			}
+			got, ok := serverWait(response, now)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("serverWait() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+			if rateLimited(response) != tt.wantRate {
+				t.Errorf("rateLimited() = %v, want %v", !tt.wantRate, tt.wantRate)
+			}
+		})
+	}
+}
+
+func Test_doWithRetry(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := requests.Add(1)
+		switch r.URL.Path {
+		case "/flaky":
+			if n < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			_, _ = w.Write([]byte("readme"))
+		case "/throttled":
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case "/exhausted":
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	defer func(n int, base time.Duration) { maxRetries, retryBaseDelay = n, base }(maxRetries, retryBaseDelay)
+	maxRetries, retryBaseDelay = 3, time.Millisecond
+
+	tests := []struct {
+		path         string
+		wantStatus   int
+		wantLimited  bool
+		wantRequests int32
+	}{
+		{"/flaky", 200, false, 3},
+		{"/throttled", 0, true, 4},
+		{"/exhausted", 0, true, 1}, // the reset is too far away to wait for
+		{"/missing", 404, false, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			requests.Store(0)
+			request, _ := http.NewRequest(http.MethodGet, srv.URL+tt.path, nil)
+			response, err := doWithRetry(httpClient, request)
+			if response != nil {
+				_ = response.Body.Close()
+			}
+			var rl *rateLimitError
+			if errors.As(err, &rl) != tt.wantLimited {
+				t.Errorf("doWithRetry() error = %v, want rate limit error: %v", err, tt.wantLimited)
+			}
+			if !tt.wantLimited && (err != nil || response.StatusCode != tt.wantStatus) {
+				t.Errorf("doWithRetry() = %v, %v, want status %d", response, err, tt.wantStatus)
+			}
+			if n := requests.Load(); n != tt.wantRequests {
+				t.Errorf("doWithRetry() sent %d requests, want %d", n, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func Test_rateLimitError_hint(t *testing.T) {
+	if got, want := (&rateLimitError{host: "raw.githubusercontent.com"}).hint(),
+		"rate limited by raw.githubusercontent.com, set an access token in GITHUB_TOKEN to raise the limit."; got != want {
+		t.Errorf("hint() = %q, want %q", got, want)
+	}
+}
+
+// temporaryError is a net.Error.
+type temporaryError struct{ timeout, temporary bool }
+
+func (e temporaryError) Error() string   { return "network error" }
+func (e temporaryError) Timeout() bool   { return e.timeout }
+func (e temporaryError) Temporary() bool { return e.temporary }
+
+func Test_transientError(t *testing.T) {
+	urlErr := func(err error) error { return &url.Error{Op: "Get", URL: "https://example.com/README.md", Err: err} }
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"connection reset", urlErr(&net.OpError{Op: "read", Err: syscall.ECONNRESET}), true},
+		{"EOF", urlErr(io.EOF), true},
+		{"unexpected EOF", urlErr(io.ErrUnexpectedEOF), true},
+		{"temporary", urlErr(temporaryError{temporary: true}), true},
+		{"timeout", urlErr(temporaryError{timeout: true, temporary: true}), false},
+		{"connection refused", urlErr(&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}), false},
+		{"unknown host", urlErr(&net.DNSError{Err: "no such host", Name: "example.com", IsNotFound: true}), false},
+		{"certificate", urlErr(x509.UnknownAuthorityError{}), false},
+		{"unsupported scheme", urlErr(errors.New(`unsupported protocol scheme "ftp"`)), false},
+		{"offline", errors.Wrap(errOffline, "refusing"), false},
+		{"canceled", urlErr(context.Canceled), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := transientError(tt.err); got != tt.want {
+				t.Errorf("transientError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_hostLimits(t *testing.T) {
+	var h hostLimits
+	ctx := context.Background()
+
+	// A request that runs when the host rate-limits another one is canceled.
+	started, result := make(chan struct{}), make(chan error)
+	go func() {
+		result <- h.do(ctx, "a.example.com", func(ctx context.Context) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		})
+	}()
+	<-started
+	limit := &rateLimitError{host: "a.example.com"}
+	if err := h.do(ctx, "a.example.com", func(context.Context) error { return limit }); err != limit {
+		t.Errorf("do() = %v, want the rate limit error", err)
+	}
+	if err := <-result; err != limit {
+		t.Errorf("do() of the running request = %v, want the rate limit error", err)
+	}
+
+	// Later requests to the host are not sent, other hosts are not affected.
+	sent := false
+	if err := h.do(ctx, "a.example.com", func(context.Context) error { sent = true; return nil }); err != limit || sent {
+		t.Errorf("do() after the rate limit = %v, request sent: %v", err, sent)
+	}
+	if err := h.do(ctx, "b.example.com", func(context.Context) error { return nil }); err != nil {
+		t.Errorf("do() for another host = %v", err)
+	}
+	if h.err() != limit {
+		t.Errorf("err() = %v, want the rate limit error", h.err())
+	}
+}
@@ -0,0 +1,147 @@
+// (C) 2017 Christoph Berger <mail@christophberger.com>. Some rights reserved.
+// Distributed under a 3-clause BSD license; see LICENSE.txt.
+
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"unicode/utf8"
+)
+
+// charRefRe matches numeric character references like &#27; or &#x1b;,
+// which the Markdown renderer decodes. Like the renderer, it accepts any
+// number of digits, including leading zeros.
+var charRefRe = regexp.MustCompile(`&#([0-9]+|[xX][0-9a-fA-F]+);`)
+
+// sanitize neutralizes terminal control functions in untrusted text, so that
+// a README cannot rewrite the screen, set the window title, write to the
+// clipboard, and the like, when goman prints it. sanitize removes
+//
+//   - escape sequences (ESC ...) including their parameters and strings,
+//   - their 8-bit equivalents (C1 controls, e.g. U+009B CSI),
+//   - all other control characters except tab and line feed.
+//
+// Numeric character references to control characters (e.g. &#27;) count
+// as the control characters themselves. Carriage returns become line feeds
+// (CR LF becomes a single line feed), and invalid UTF-8 becomes U+FFFD.
+//
+// mdToAnsi sanitizes the README before rendering, so the ANSI styling that
+// the renderer adds is not affected.
+func sanitize(text []byte) []byte {
+	text = decodeControlRefs(text)
+	out := make([]byte, 0, len(text))
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRune(text[i:])
+		switch {
+		case r == utf8.RuneError && size <= 1:
+			out = utf8.AppendRune(out, utf8.RuneError)
+			i++
+		case r == '\t' || r == '\n':
+			out = append(out, byte(r))
+			i++
+		case r == '\r':
+			if i+1 >= len(text) || text[i+1] != '\n' {
+				out = append(out, '\n')
+			}
+			i++
+		case r == 0x1b:
+			i = skipEscape(text, i+1)
+		case r >= 0x80 && r <= 0x9f:
+			i = skipControl(text, i+size, r)
+		case r < 0x20 || r == 0x7f:
+			i++
+		default:
+			out = append(out, text[i:i+size]...)
+			i += size
+		}
+	}
+	return out
+}
+
+// decodeControlRefs replaces numeric character references to control
+// characters other than tab and line feed with the characters, so that
+// sanitize removes them together with the sequences that they start.
+// A reference to a number too large to parse becomes NUL, which sanitize
+// removes as well. All other references stay as they are.
+func decodeControlRefs(text []byte) []byte {
+	return charRefRe.ReplaceAllFunc(text, func(ref []byte) []byte {
+		num, base := string(ref[2:len(ref)-1]), 10
+		if num[0] == 'x' || num[0] == 'X' {
+			num, base = num[1:], 16
+		}
+		r, err := strconv.ParseInt(num, base, 32)
+		switch {
+		case err != nil:
+			return []byte{0}
+		case r != '\t' && r != '\n' && (r < 0x20 || r >= 0x7f && r <= 0x9f):
+			return utf8.AppendRune(nil, rune(r))
+		}
+		return ref
+	})
+}
+
+// skipEscape returns the index after the escape sequence that starts
+// with the byte after ESC at index i.
+func skipEscape(text []byte, i int) int {
+	if i >= len(text) {
+		return i
+	}
+	c := text[i]
+	switch {
+	case c >= 0x40 && c <= 0x5f:
+		// ESC [ is CSI, ESC ] is OSC, and so on.
+		return skipControl(text, i+1, rune(c)+0x40)
+	case c >= 0x20 && c <= 0x2f:
+		// Intermediate bytes, followed by a final byte
+		for i < len(text) && text[i] >= 0x20 && text[i] <= 0x2f {
+			i++
+		}
+		if i < len(text) && text[i] >= 0x30 && text[i] <= 0x7e {
+			i++
+		}
+		return i
+	case c >= 0x30 && c <= 0x7e:
+		// Two-character sequence, like ESC c (reset)
+		return i + 1
+	}
+	return i
+}
+
+// skipControl returns the index after the arguments of C1 control c,
+// which end before index i.
+func skipControl(text []byte, i int, c rune) int {
+	switch c {
+	case 0x9b: // CSI: parameter bytes, intermediate bytes, final byte
+		for i < len(text) && text[i] >= 0x20 && text[i] <= 0x3f {
+			i++
+		}
+		if i < len(text) && text[i] >= 0x40 && text[i] <= 0x7e {
+			i++
+		}
+		return i
+	case 0x90, 0x98, 0x9d, 0x9e, 0x9f: // DCS, SOS, OSC, PM, APC: control string
+		return skipControlString(text, i)
+	}
+	return i
+}
+
+// skipControlString returns the index after a control string, which ends
+// with BEL, ST (ESC \ or U+009C), or, to limit the damage of an
+// unterminated string, at the end of the line.
+func skipControlString(text []byte, i int) int {
+	for i < len(text) {
+		switch {
+		case text[i] == 0x07:
+			return i + 1
+		case text[i] == 0x1b && i+1 < len(text) && text[i+1] == '\\':
+			return i + 2
+		case text[i] == 0xc2 && i+1 < len(text) && text[i+1] == 0x9c:
+			return i + 2
+		case text[i] == '\n':
+			return i
+		}
+		i++
+	}
+	return i
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func Test_sanitize(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"plain", "# Title\n\n\tcode\n", "# Title\n\n\tcode\n"},
+		{"unicode", "Grüße, 世界 🙂", "Grüße, 世界 🙂"},
+		{"window title", "a\x1b]0;pwned\x07b", "ab"},
+		{"window title ST", "a\x1b]2;pwned\x1b\\b", "ab"},
+		{"hyperlink", "\x1b]8;;https://evil.example.com\x1b\\link\x1b]8;;\x1b\\", "link"},
+		{"clipboard", "a\x1b]52;c;cm0gLXJmIH4K\x07b", "ab"},
+		{"unterminated OSC", "a\x1b]0;pwned\nb", "a\nb"},
+		{"clear screen", "a\x1b[2J\x1b[Hb", "ab"},
+		{"hidden text", "\x1b[8mhidden\x1b[0m", "hidden"},
+		{"private CSI", "a\x1b[?1049hb", "ab"},
+		{"reset", "a\x1bcb", "ab"},
+		{"charset", "a\x1b(0b", "ab"},
+		{"DCS", "a\x1bP1$qm\x1b\\b", "ab"},
+		{"C1 CSI", "a\u009b31mb", "ab"},
+		{"C1 OSC", "a\u009d0;title\u009cb", "ab"},
+		{"C0 controls", "a\x00\x07\x08\x7fb", "ab"},
+		{"CR LF", "a\r\nb", "a\nb"},
+		{"CR", "a\rb", "a\nb"},
+		{"invalid UTF-8", "a\xffb", "a�b"},
+		{"trailing ESC", "a\x1b", "a"},
+		{"character references", "a&#27;]0;x&#7; &#x1B;[2J &#10; &#xe9; &amp; &#155;31mb", "a  &#10; &#xe9; &amp; b"},
+		{"padded character references", "a&#x00000001b;[2J &#0000000027;]0;title&#x0007;b", "a b"},
+		{"overflowing character references", "a&#99999999999999999999;&#x1000000000000001b;b", "ab"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(sanitize([]byte(tt.text))); got != tt.want {
+				t.Errorf("sanitize(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+// sgrRe matches the SGR (styling) sequences that the renderer emits.
+var sgrRe = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+func Test_mdToAnsi_hostile(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "hostile", "*.md"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no hostile READMEs in testdata/hostile: %v", err)
+	}
+	for _, fp := range files {
+		t.Run(filepath.Base(fp), func(t *testing.T) {
+			readme, err := os.ReadFile(fp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out := sgrRe.ReplaceAllString(string(mdToAnsi(readme)), "")
+			if i := strings.IndexFunc(out, func(r rune) bool {
+				return r < 0x20 && r != '\n' && r != '\t' || r >= 0x7f && r <= 0x9f
+			}); i >= 0 {
+				t.Errorf("mdToAnsi() output contains control character %q at %d: %q", out[i], i, out)
+			}
+			if strings.Contains(out, "pwned") && strings.Contains(string(readme), "\x1b]0;pwned") {
+				t.Errorf("mdToAnsi() output contains the payload of an escape sequence: %q", out)
+			}
+		})
+	}
+}
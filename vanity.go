@@ -0,0 +1,187 @@
+// (C) 2017 Christoph Berger <mail@christophberger.com>. Some rights reserved.
+// Distributed under a 3-clause BSD license; see LICENSE.txt.
+
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// metaImport is the content of a go-import meta tag, plus the content
+// of the go-source meta tag with the same prefix, if any.
+//
+//	<meta name="go-import" content="import-prefix vcs repo-root [subdir]">
+//	<meta name="go-source" content="import-prefix home directory file">
+type metaImport struct {
+	Prefix   string // import path prefix, e.g. golang.org/x/tools
+	VCS      string // git, hg, svn, bzr, fossil, or mod
+	RepoRoot string // e.g. https://go.googlesource.com/tools
+	SubDir   string // optional subdirectory of the module inside the repository
+	Home     string // go-source: project home page
+	// Configured is true for module path overrides from the configuration
+	// file, which may point to a local repository with a file:// URL.
+	Configured bool
+}
+
+// repo returns the repository root as a scheme-less path like the ones
+// possibleReadmeURLs() expects, e.g. go.googlesource.com/tools.
+// If the repo-root is no web URL (for example, an ssh:// URL), repo falls back
+// to the home page from the go-source tag.
+func (mi metaImport) repo() string {
+	root := mi.RepoRoot
+	if !strings.HasPrefix(root, "https://") && !strings.HasPrefix(root, "http://") && mi.Home != "" {
+		root = mi.Home
+	}
+	if i := strings.Index(root, "://"); i >= 0 {
+		root = root[i+3:]
+	}
+	root = strings.Trim(root, "/")
+	return strings.TrimSuffix(root, ".git")
+}
+
+// repository returns the repository of module mod, whose path starts with
+// the import prefix of mi.
+//
+// Example:
+//
+// Module golang.org/x/tools/gopls, with prefix golang.org/x/tools and
+// repo-root https://go.googlesource.com/tools, lives in the
+// repository go.googlesource.com/tools in subdirectory gopls.
+func (mi metaImport) repository(mod string) repository {
+	rest, major := splitMajor(strings.TrimPrefix(mod, mi.Prefix))
+	return repository{
+		Root:       mi.repo(),
+		Subdir:     path.Join(strings.Trim(mi.SubDir, "/"), strings.Trim(rest, "/")),
+		Major:      major,
+		URL:        mi.RepoRoot,
+		VCS:        mi.VCS,
+		Configured: mi.Configured,
+	}
+}
+
+// resolveVanityImport asks the server behind src for its go-import meta tag,
+// the same way the go command does, and returns the entry that matches src.
+func resolveVanityImport(src string) (*metaImport, error) {
+
+	url := "https://" + src + "?go-get=1"
+	response, err := httpClient.Get(url)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed retrieving header data of URL "+url)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 200 {
+		return nil, errors.New("HTTP GET returned " + response.Status + " for URL " + url)
+	}
+
+	imports, err := parseMetaGoImports(response.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot parse go-import meta tags from "+url)
+	}
+
+	mi := matchMetaImport(imports, src)
+	if mi == nil {
+		return nil, errors.New("no go-import meta tag for " + src + " found at " + url)
+	}
+	return mi, nil
+}
+
+// parseMetaGoImports returns the go-import meta tags from the HTML in r.
+// go-source tags are merged into the go-import tag with the same prefix.
+// Parsing ends at the end of the <head> section or the beginning of the <body>.
+//
+// The code is modeled after cmd/go/internal/vcs/discovery.go.
+func parseMetaGoImports(r io.Reader) ([]metaImport, error) {
+	d := xml.NewDecoder(r)
+	d.CharsetReader = charsetReader
+	d.Strict = false
+
+	var imports []metaImport
+	homes := map[string]string{}
+	for {
+		t, err := d.RawToken()
+		if err != nil {
+			if err != io.EOF && len(imports) == 0 {
+				return nil, err
+			}
+			break
+		}
+		if e, ok := t.(xml.StartElement); ok && strings.EqualFold(e.Name.Local, "body") {
+			break
+		}
+		if e, ok := t.(xml.EndElement); ok && strings.EqualFold(e.Name.Local, "head") {
+			break
+		}
+		e, ok := t.(xml.StartElement)
+		if !ok || !strings.EqualFold(e.Name.Local, "meta") {
+			continue
+		}
+		f := strings.Fields(attrValue(e.Attr, "content"))
+		switch attrValue(e.Attr, "name") {
+		case "go-import":
+			if len(f) == 3 || len(f) == 4 {
+				mi := metaImport{Prefix: f[0], VCS: f[1], RepoRoot: f[2]}
+				if len(f) == 4 {
+					mi.SubDir = f[3]
+				}
+				imports = append(imports, mi)
+			}
+		case "go-source":
+			if len(f) == 4 {
+				homes[f[0]] = f[1]
+			}
+		}
+	}
+
+	for i := range imports {
+		imports[i].Home = homes[imports[i].Prefix]
+	}
+	return imports, nil
+}
+
+// matchMetaImport returns the import whose prefix is the longest
+// path prefix of src. Entries of type "mod" point to a module proxy
+// rather than to a repository, so they are skipped.
+func matchMetaImport(imports []metaImport, src string) *metaImport {
+	var match *metaImport
+	for i, mi := range imports {
+		if mi.VCS == "mod" {
+			continue
+		}
+		if src != mi.Prefix && !strings.HasPrefix(src, mi.Prefix+"/") {
+			continue
+		}
+		if match == nil || len(mi.Prefix) > len(match.Prefix) {
+			match = &imports[i]
+		}
+	}
+	return match
+}
+
+// charsetReader returns a reader that converts from the given charset to UTF-8.
+// Like the go command, it only supports UTF-8 and ASCII.
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "utf-8", "ascii":
+		return input, nil
+	default:
+		return nil, fmt.Errorf("can't decode XML document using charset %q", charset)
+	}
+}
+
+// attrValue returns the attribute value for the case-insensitive key
+// `name`, or the empty string if nothing is found.
+func attrValue(attrs []xml.Attr, name string) string {
+	for _, a := range attrs {
+		if strings.EqualFold(a.Name.Local, name) {
+			return a.Value
+		}
+	}
+	return ""
+}
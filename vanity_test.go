@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const vanityPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta http-equiv="Content-Type" content="text/html; charset=utf-8"/>
+<meta name="go-import" content="%[1]s/tools git https://go.googlesource.com/tools">
+<meta name="go-import" content="%[1]s/tools mod https://proxy.example.com">
+<meta name="go-source" content="%[1]s/tools https://github.com/golang/tools/ https://github.com/golang/tools/tree/master{/dir} https://github.com/golang/tools/blob/master{/dir}/{file}#L{line}">
+<meta name="go-import" content="%[1]s/private git ssh://git@git.example.com/private.git">
+<meta name="go-source" content="%[1]s/private https://git.example.com/private https://git.example.com/private/tree{/dir} https://git.example.com/private/blob{/dir}/{file}">
+</head>
+<body>
+<meta name="go-import" content="%[1]s/ignored git https://example.com/ignored">
+</body>
+</html>`
+
+func Test_parseMetaGoImports(t *testing.T) {
+	page := fmt.Sprintf(vanityPage, "golang.org/x")
+	got, err := parseMetaGoImports(strings.NewReader(page))
+	if err != nil {
+		t.Fatalf("parseMetaGoImports(): %v", err)
+	}
+	want := []metaImport{
+		{Prefix: "golang.org/x/tools", VCS: "git", RepoRoot: "https://go.googlesource.com/tools", Home: "https://github.com/golang/tools/"},
+		{Prefix: "golang.org/x/tools", VCS: "mod", RepoRoot: "https://proxy.example.com", Home: "https://github.com/golang/tools/"},
+		{Prefix: "golang.org/x/private", VCS: "git", RepoRoot: "ssh://git@git.example.com/private.git", Home: "https://git.example.com/private"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseMetaGoImports()\ngot  %v\nwant %v", got, want)
+	}
+}
+
+func Test_metaImport_repository(t *testing.T) {
+	tests := []struct {
+		name string
+		mi   metaImport
+		mod  string
+		want repository
+	}{
+		{"root", metaImport{Prefix: "npf.io/gorram", RepoRoot: "https://github.com/natefinch/gorram"}, "npf.io/gorram", repository{Root: "github.com/natefinch/gorram", URL: "https://github.com/natefinch/gorram"}},
+		{"submodule", metaImport{Prefix: "golang.org/x/tools", RepoRoot: "https://go.googlesource.com/tools"}, "golang.org/x/tools/gopls", repository{Root: "go.googlesource.com/tools", Subdir: "gopls", URL: "https://go.googlesource.com/tools"}},
+		{"dotgit", metaImport{Prefix: "go.uber.org/zap", RepoRoot: "https://github.com/uber-go/zap.git"}, "go.uber.org/zap", repository{Root: "github.com/uber-go/zap", URL: "https://github.com/uber-go/zap.git"}},
+		{"major", metaImport{Prefix: "go.uber.org/zap", RepoRoot: "https://github.com/uber-go/zap.git"}, "go.uber.org/zap/v2", repository{Root: "github.com/uber-go/zap", Major: "v2", URL: "https://github.com/uber-go/zap.git"}},
+		{"ssh", metaImport{Prefix: "example.com/p", RepoRoot: "ssh://git@git.example.com/p.git", Home: "https://git.example.com/p"}, "example.com/p", repository{Root: "git.example.com/p", URL: "ssh://git@git.example.com/p.git"}},
+		{"modsubdir", metaImport{Prefix: "example.com/mod", RepoRoot: "https://github.com/user/repo", SubDir: "mod"}, "example.com/mod", repository{Root: "github.com/user/repo", Subdir: "mod", URL: "https://github.com/user/repo"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.mi.repository(tt.mod); got != tt.want {
+				t.Errorf("repository() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_resolveVanityImport(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("go-get") != "1" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, vanityPage, r.Host+"/x")
+	}))
+	defer srv.Close()
+
+	defer func(c *http.Client) { httpClient = c }(httpClient)
+	httpClient = srv.Client()
+
+	host := strings.TrimPrefix(srv.URL, "https://")
+
+	tests := []struct {
+		name    string
+		src     string
+		want    string
+		wantErr bool
+	}{
+		{"tools", host + "/x/tools/cmd/stringer", "go.googlesource.com/tools", false},
+		{"private", host + "/x/private", "git.example.com/private", false},
+		{"nomatch", host + "/x/toolsextra", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mi, err := resolveVanityImport(tt.src)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveVanityImport() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := mi.repo(); got != tt.want {
+				t.Errorf("resolveVanityImport() resolves to repository %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_remoteLocations(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != "gitlab.example.com" || r.URL.Query().Get("go-get") != "1" {
+			t.Errorf("unexpected request to %s%s", r.Host, r.URL)
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `<meta name="go-import" content="gitlab.example.com/group/sub/repo git https://gitlab.example.com/group/sub/repo.git">`)
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	defer func(c *http.Client, f []forge, v *bool) { httpClient, forges, verbose = c, f, v }(httpClient, forges, verbose)
+	httpClient = &http.Client{Transport: hostHeader{toServer{u}}}
+	verbose = new(bool)
+	_ = registerForge("gitlab", "gitlab.example.com", "")
+	_ = registerForge("gitea", "gitea.example.com", "")
+
+	tests := []struct {
+		name     string
+		pkg      string
+		mod      string
+		wantRoot string
+		wantLoc  location
+	}{
+		{"gitlab subgroup, nested module", "gitlab.example.com/group/sub/repo/tools/cmd/tool", "gitlab.example.com/group/sub/repo/tools",
+			"gitlab.example.com/group/sub/repo", location{Root: "gitlab.example.com/group/sub/repo", Dir: "tools/cmd/tool"}},
+		{"gitea nested module without request", "gitea.example.com/user/repo/tools/cmd/tool", "gitea.example.com/user/repo/tools",
+			"gitea.example.com/user/repo", location{Root: "gitea.example.com/user/repo", Dir: "tools/cmd/tool"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, locs := remoteLocations(tt.pkg, tt.mod)
+			if repo.Root != tt.wantRoot || len(locs) == 0 || locs[0] != tt.wantLoc {
+				t.Errorf("remoteLocations() = %+v, %v, want root %s and first location %v", repo, locs, tt.wantRoot, tt.wantLoc)
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+// (C) 2017 Christoph Berger <mail@christophberger.com>. Some rights reserved.
+// Distributed under a 3-clause BSD license; see LICENSE.txt.
+
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// findRepoReadme is a helper function for findReadme. It fetches the README
+// from the repository itself, with the tool of the version control system
+// that the go-import meta tag names.
+func findRepoReadme(repo repository, locs []location, ref string) (readme []byte, source string, exact bool, err error) {
+	if repo.VCS == "" || repo.VCS == "git" {
+		return findGitReadme(repo, locs, ref)
+	}
+	return findVCSReadme(repo, locs, ref)
+}
+
+// vcsAdapter describes how to read a file at a revision from a repository
+// of a version control system other than Git, with the system's
+// command-line tool. The functions return the arguments for the tool.
+type vcsAdapter struct {
+	cmd  string // the command-line tool
+	head string // the revision of the latest commit on the default branch
+	// rev translates a Git-style ref (a version tag or a commit ID) to a
+	// revision, or returns "" if the system has no equivalent.
+	rev func(ref string) string
+	// local is the name of the local copy of the repository, for tools that
+	// cannot read files from a remote repository; clone creates the copy.
+	local string
+	clone func(url string) []string
+	// list lists the files in directory dir at rev, one per line, and may be
+	// nil if the tool cannot list files without a checkout. findVCSReadme
+	// then tries the usual README file names.
+	list func(src, rev, dir string) []string
+	// cat prints file at rev. src is the local copy or the repository URL.
+	cat func(src, rev, file string) []string
+}
+
+// vcsAdapters are the version control systems that a go-import meta tag may
+// name, except Git, which findGitReadme handles.
+var vcsAdapters = map[string]vcsAdapter{
+	"hg": {
+		cmd:   "hg",
+		head:  "default",
+		rev:   func(ref string) string { return ref },
+		local: "repo",
+		clone: func(url string) []string {
+			return []string{"clone", "--noninteractive", "--noupdate", "--", url, "repo"}
+		},
+		list: func(src, rev, dir string) []string {
+			return []string{"files", "-R", src, "-r", rev, "--", "rootfilesin:" + cmp.Or(dir, ".")}
+		},
+		cat: func(src, rev, file string) []string {
+			return []string{"cat", "-R", src, "-r", rev, "--", "path:" + file}
+		},
+	},
+	"fossil": {
+		cmd:   "fossil",
+		head:  "trunk",
+		rev:   func(ref string) string { return ref },
+		local: "repo.fossil",
+		clone: func(url string) []string { return []string{"clone", "--", url, "repo.fossil"} },
+		cat:   func(src, rev, file string) []string { return []string{"cat", "-R", src, "-r", rev, "--", file} },
+	},
+	"bzr": {
+		cmd:  "bzr",
+		head: "-1",
+		rev: func(ref string) string {
+			if isVersionTag(ref) {
+				return "tag:" + ref
+			}
+			return ""
+		},
+		list: func(src, rev, dir string) []string {
+			return []string{"ls", "--kind=file", "-r", rev, "--", strings.TrimSuffix(src+"/"+dir, "/")}
+		},
+		cat: func(src, rev, file string) []string { return []string{"cat", "-r", rev, "--", src + "/" + file} },
+	},
+	"svn": {
+		cmd:  "svn",
+		head: "HEAD",
+		// Pseudo-versions of Subversion modules contain the revision number, zero-padded.
+		rev: func(ref string) string {
+			if ref == "" || strings.Trim(ref, "0123456789") != "" {
+				return ""
+			}
+			if r := strings.TrimLeft(ref, "0"); r != "" {
+				return r
+			}
+			return "0"
+		},
+		list: func(src, rev, dir string) []string {
+			return []string{"ls", "--non-interactive", "--", strings.TrimSuffix(src+"/"+dir, "/") + "@" + rev}
+		},
+		cat: func(src, rev, file string) []string {
+			return []string{"cat", "--non-interactive", "--", src + "/" + file + "@" + rev}
+		},
+	},
+}
+
+// findVCSReadme fetches the README from a Mercurial, Fossil, Bazaar, or
+// Subversion repository. Subversion and Bazaar read files from the remote
+// repository; Mercurial and Fossil need a local copy, so findVCSReadme clones
+// the repository (without a checkout) into a temporary directory first.
+// The README is searched in the directories of locs that belong to repo,
+// at ref, or at the tip of the default branch.
+func findVCSReadme(repo repository, locs []location, ref string) (readme []byte, source string, exact bool, err error) {
+	a, ok := vcsAdapters[repo.VCS]
+	if !ok {
+		return nil, "", false, errors.Errorf("cannot fetch the README from %s: unsupported version control system %q", repo.cloneURL(), repo.VCS)
+	}
+	if err := checkRepoURL(repo.VCS, repo.cloneURL(), repo.Configured); err != nil {
+		return nil, "", false, err
+	}
+	if _, err := exec.LookPath(a.cmd); err != nil {
+		return nil, "", false, errors.Errorf("%s is not installed, cannot fetch the README from the %s repository %s", a.cmd, repo.VCS, repo.cloneURL())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), vcsTimeout)
+	defer cancel()
+
+	dir, err := os.MkdirTemp("", "goman-"+repo.VCS+"-")
+	if err != nil {
+		return nil, "", false, errors.Wrap(err, "cannot create a temporary directory")
+	}
+	defer os.RemoveAll(dir)
+
+	t := vcsTool{ctx: ctx, cmd: a.cmd, dir: dir}
+	src := repo.cloneURL()
+	if a.clone != nil {
+		if _, err := t.run(a.clone(src)...); err != nil {
+			return nil, "", false, err
+		}
+		src = a.local
+	}
+
+	rev := a.rev(ref)
+	for i, r := range candidateRefs(rev, a.head) {
+		for _, d := range repoDirs(repo, locs) {
+			readme, file, e := t.readme(a, src, r, d)
+			if e != nil {
+				err = e
+				continue
+			}
+			return readme, a.cmd + " " + repo.cloneURL() + " " + r + ":" + file, rev != "" && i == 0 && isImmutableRef(ref), nil
+		}
+	}
+	return nil, "", false, errors.Wrapf(err, "no README in the %s repository %s", repo.VCS, repo.cloneURL())
+}
+
+// vcsTool runs a version control tool in a temporary directory.
+type vcsTool struct {
+	ctx context.Context
+	cmd string
+	dir string
+}
+
+// run runs the tool with args.
+func (t vcsTool) run(args ...string) ([]byte, error) {
+	cmd := t.command(args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s %s failed: %s", t.cmd, strings.Join(args, " "), strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// command returns the command for running the tool with args. Like the go
+// command, it gives the tool no terminal input, so that it cannot ask for
+// credentials. HGPLAIN keeps the output of Mercurial free of user settings.
+func (t vcsTool) command(args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(t.ctx, t.cmd, args...)
+	cmd.Dir = t.dir
+	cmd.Env = append(os.Environ(), "HGPLAIN=1")
+	return cmd
+}
+
+// readme returns the README in directory dir of src at rev, and its path.
+func (t vcsTool) readme(a vcsAdapter, src, rev, dir string) ([]byte, string, error) {
+	candidates := names
+	if a.list != nil {
+		out, err := t.run(a.list(src, rev, dir)...)
+		if err != nil {
+			return nil, "", err
+		}
+		var files []string
+		for _, f := range strings.Split(string(out), "\n") {
+			// Directories end with a slash in the output of svn.
+			if f = strings.TrimSpace(f); f != "" && !strings.HasSuffix(f, "/") {
+				files = append(files, path.Base(f))
+			}
+		}
+		name := pickReadme(files)
+		if name == "" {
+			return nil, "", errNotFound{"no README in directory /" + dir}
+		}
+		candidates = []string{name}
+	}
+
+	var err error
+	for _, name := range candidates {
+		file := path.Join(dir, name)
+		var readme []byte
+		readme, err = commandReadme(t.command(a.cat(src, rev, file)...))
+		if err != nil {
+			if *verbose {
+				log.Println(err)
+			}
+			continue
+		}
+		return readme, file, nil
+	}
+	return nil, "", err
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// fakeVCSTools installs shell scripts that stand in for version control
+// tools. Each script prints the recorded output for the arguments it knows,
+// and fails like the real tool otherwise.
+func fakeVCSTools(t *testing.T, scripts map[string]string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake tools are shell scripts")
+	}
+	dir := t.TempDir()
+	for name, script := range scripts {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", dir)
+}
+
+func Test_findVCSReadme(t *testing.T) {
+	fakeVCSTools(t, map[string]string{
+		"svn": `case "$*" in
+"ls --non-interactive -- https://svn.example.com/repo/cmd/tool@HEAD") printf 'main.go\nREADME.txt\ndocs/\n' ;;
+"cat --non-interactive -- https://svn.example.com/repo/cmd/tool/README.txt@HEAD") printf 'Tool\n' ;;
+"ls --non-interactive -- https://svn.example.com/repo@1234") printf 'README\ncmd/\n' ;;
+"cat --non-interactive -- https://svn.example.com/repo/README@1234") printf 'Revision 1234\n' ;;
+*) echo "svn: E170000: URL does not exist in revision" >&2; exit 1 ;;
+esac
+`,
+		"hg": `case "$*" in
+"clone --noninteractive --noupdate -- https://hg.example.com/repo repo") : ;;
+"files -R repo -r v1.0.0 -- rootfilesin:cmd/tool") printf 'repo/cmd/tool/main.go\n' ;;
+"files -R repo -r v1.0.0 -- rootfilesin:.") printf 'repo/.hgtags\nrepo/readme.md\n' ;;
+"cat -R repo -r v1.0.0 -- path:readme.md") printf '# Mercurial\n' ;;
+*) echo "abort: unknown revision" >&2; exit 255 ;;
+esac
+`,
+		"fossil": `case "$*" in
+"clone -- https://fossil.example.com/repo repo.fossil") : ;;
+"cat -R repo.fossil -r trunk -- README") printf 'Fossil\n' ;;
+*) echo "no such file" >&2; exit 1 ;;
+esac
+`,
+	})
+
+	defer func(v *bool) { verbose = v }(verbose)
+	verbose = new(bool)
+
+	tests := []struct {
+		name       string
+		repo       repository
+		dirs       []string
+		ref        string
+		want       string
+		wantSource string
+		wantExact  bool
+		wantErr    string
+	}{
+		{"svn listing", repository{Root: "svn.example.com/repo", VCS: "svn"}, []string{"cmd/tool", ""}, "",
+			"Tool\n", "svn https://svn.example.com/repo HEAD:cmd/tool/README.txt", false, ""},
+		{"svn revision from pseudo-version", repository{Root: "svn.example.com/repo", VCS: "svn"}, []string{"cmd/other", ""}, "000000001234",
+			"Revision 1234\n", "svn https://svn.example.com/repo 1234:README", true, ""},
+		{"hg clone and tag", repository{Root: "hg.example.com/repo", VCS: "hg"}, []string{"cmd/tool", ""}, "v1.0.0",
+			"# Mercurial\n", "hg https://hg.example.com/repo v1.0.0:readme.md", true, ""},
+		{"fossil without listing", repository{Root: "fossil.example.com/repo", VCS: "fossil"}, []string{""}, "",
+			"Fossil\n", "fossil https://fossil.example.com/repo trunk:README", false, ""},
+		{"missing tool", repository{Root: "bzr.example.com/repo", VCS: "bzr"}, []string{""}, "",
+			"", "", false, "bzr is not installed"},
+		{"unknown vcs", repository{Root: "cvs.example.com/repo", VCS: "cvs"}, []string{""}, "",
+			"", "", false, "unsupported version control system"},
+		{"local repository", repository{Root: "svn.example.com/repo", URL: "file:///var/svn/repo", VCS: "svn"}, []string{""}, "",
+			"", "", false, `scheme "file" is not allowed for svn`},
+		{"option as URL", repository{Root: "hg.example.com/repo", URL: "--config=hooks.pre-clone=touch /tmp/x", VCS: "hg"}, []string{""}, "",
+			"", "", false, "invalid repository URL"},
+		{"scheme of another vcs", repository{Root: "fossil.example.com/repo", URL: "ssh://fossil.example.com/repo", VCS: "fossil"}, []string{""}, "",
+			"", "", false, `scheme "ssh" is not allowed for fossil`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var locs []location
+			for _, d := range tt.dirs {
+				locs = append(locs, location{Root: tt.repo.Root, Dir: d})
+			}
+			got, source, exact, err := findRepoReadme(tt.repo, locs, tt.ref)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("findRepoReadme() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("findRepoReadme() error = %v", err)
+			}
+			if string(got) != tt.want || source != tt.wantSource || exact != tt.wantExact {
+				t.Errorf("findRepoReadme() = %q, %q, %v, want %q, %q, %v", got, source, exact, tt.want, tt.wantSource, tt.wantExact)
+			}
+		})
+	}
+}
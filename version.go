@@ -0,0 +1,45 @@
+// (C) 2017 Christoph Berger <mail@christophberger.com>. Some rights reserved.
+// Distributed under a 3-clause BSD license; see LICENSE.txt.
+
+package main
+
+import (
+	"strings"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// gitRef maps a module version to the ref in the module's repository
+// that the version was created from:
+//
+//   - A pseudo-version like v0.0.0-20240101120000-abcdef123456 maps to
+//     the commit hash abcdef123456.
+//   - An incompatible version like v3.1.0+incompatible maps to the tag v3.1.0.
+//   - A semantic version like v1.2.3 maps to the tag v1.2.3. If the module
+//     lives in subdirectory `subdir` of the repository, the tag is prefixed
+//     with that directory, as in tools/v1.2.3.
+//
+// Major version suffixes are not part of the tag. The tag v2.0.0 is the same,
+// no matter whether the module path github.com/user/repo/v2 is implemented
+// in the v2/ subdirectory or at the root of the branch. The candidate
+// locations that repository.locations generates cover both layouts.
+//
+// For anything else, including an empty version, gitRef returns an empty string.
+func gitRef(ver, subdir string) string {
+	if !semver.IsValid(ver) {
+		return ""
+	}
+	if module.IsPseudoVersion(ver) {
+		rev, err := module.PseudoVersionRev(ver)
+		if err != nil {
+			return ""
+		}
+		return rev
+	}
+	ver = strings.TrimSuffix(ver, "+incompatible")
+	if subdir != "" {
+		return subdir + "/" + ver
+	}
+	return ver
+}
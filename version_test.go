@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func Test_gitRef(t *testing.T) {
+	tests := []struct {
+		name   string
+		ver    string
+		subdir string
+		want   string
+	}{
+		{"empty", "", "", ""},
+		{"devel", "(devel)", "", ""},
+		{"tag", "v1.2.3", "", "v1.2.3"},
+		{"prerelease", "v1.2.3-rc.1", "", "v1.2.3-rc.1"},
+		{"major", "v2.0.1", "", "v2.0.1"},
+		{"subdir", "v0.16.1", "gopls", "gopls/v0.16.1"},
+		{"incompatible", "v3.1.0+incompatible", "", "v3.1.0"},
+		{"pseudo", "v0.0.0-20240101120000-abcdef123456", "", "abcdef123456"},
+		{"pseudo after tag", "v1.2.4-0.20240101120000-abcdef123456", "", "abcdef123456"},
+		{"pseudo prerelease", "v1.2.3-pre.0.20240101120000-abcdef123456", "sub", "abcdef123456"},
+		{"pseudo incompatible", "v3.1.1-0.20240101120000-abcdef123456+incompatible", "", "abcdef123456"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := gitRef(tt.ver, tt.subdir); got != tt.want {
+				t.Errorf("gitRef(%q, %q) = %q, want %q", tt.ver, tt.subdir, got, tt.want)
+			}
+		})
+	}
+}